@@ -2,19 +2,68 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ryota-sakamoto/c8go/code"
 	"github.com/ryota-sakamoto/c8go/node"
+	"github.com/ryota-sakamoto/c8go/preprocess"
 	"github.com/ryota-sakamoto/c8go/token"
 )
 
 func main() {
-	if len(os.Args) < 2 {
+	includePaths := []string{}
+	preprocessOnly := false
+	maxErrors := -1
+	args := []string{}
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "-E":
+			preprocessOnly = true
+		case arg == "-I" && i+1 < len(os.Args):
+			i++
+			includePaths = append(includePaths, os.Args[i])
+		case strings.HasPrefix(arg, "-I") && len(arg) > 2:
+			includePaths = append(includePaths, arg[2:])
+		case strings.HasPrefix(arg, "-fmax-errors="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "-fmax-errors="))
+			if err != nil || n < 0 {
+				fmt.Println(fmt.Sprintf("invalid argument: %s", arg))
+				os.Exit(1)
+			}
+			maxErrors = n
+		default:
+			args = append(args, arg)
+		}
+	}
+	if len(args) < 1 {
 		panic("Invalud args len")
 	}
 
-	s := os.Args[1]
+	// the argument is the source itself unless it names a file
+	src, file := args[0], "<input>"
+	if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		src, file = string(data), args[0]
+	}
+
+	s, err := preprocess.NewPreprocessor(includePaths).Run(src, file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if preprocessOnly {
+		fmt.Print(s)
+		return
+	}
+
 	token, err := token.Tokenize(s)
 	if err != nil {
 		fmt.Println(err)
@@ -22,9 +71,12 @@ func main() {
 	}
 
 	parser := node.NewNodeParser(token)
+	if maxErrors >= 0 {
+		parser.MaxErrors = maxErrors
+	}
 	node, err := parser.Program()
 	if err != nil {
-		fmt.Println(fmt.Sprintf("%+v", err))
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
@@ -2,8 +2,10 @@ package code
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/ryota-sakamoto/c8go/node"
+	"github.com/ryota-sakamoto/c8go/vars"
 )
 
 type Generator struct {
@@ -16,7 +18,6 @@ func NewGenerator() *Generator {
 
 func (g *Generator) Before() {
 	fmt.Println(".intel_syntax noprefix")
-	fmt.Println(".global main")
 }
 
 func (g *Generator) After() {
@@ -33,46 +34,114 @@ func (g *Generator) Run(n *node.Node) {
 func gen(n *node.Node) {
 	switch n.Kind {
 	case node.ND_FUNC:
+		if !n.Static {
+			fmt.Println(fmt.Sprintf(".global %s", n.Name))
+		}
 		fmt.Println(n.Name + ":")
 
 		fmt.Println("    push rbp")
 		fmt.Println("    mov rbp, rsp")
-		fmt.Println("    sub rsp, 208")
+		fmt.Println(fmt.Sprintf("    sub rsp, %d", n.StackSize))
+
+		// all argument registers are saved for va_arg of a variadic function
+		if n.VaArea != nil {
+			fmt.Println("    mov rax, rbp")
+			fmt.Println(fmt.Sprintf("    sub rax, %d", n.VaArea.Offset))
+			for i, reg := range argReg64 {
+				fmt.Println(fmt.Sprintf("    mov [rax + %d], %s", i*8, reg))
+			}
+			for i := 0; i < argRegFloatLen; i++ {
+				fmt.Println(fmt.Sprintf("    movsd [rax + %d], xmm%d", len(argReg64)*8+i*16, i))
+			}
+		}
 
-		for i, offset := range n.DefineArgsOffset {
+		gp, fp, stack := 0, 0, 0
+		for _, arg := range n.DefineArgs {
 			fmt.Println("    mov rax, rbp")
-			fmt.Println(fmt.Sprintf("    sub rax, %d", offset))
+			fmt.Println(fmt.Sprintf("    sub rax, %d", arg.Offset))
+
+			if arg.IsFloat() && fp < argRegFloatLen {
+				fmt.Println(fmt.Sprintf("    mov%s [rax], xmm%d", floatSuffix(arg), fp))
+				fp++
+				continue
+			}
 
-			switch i {
-			case 0:
-				fmt.Println("    mov [rax], rdi")
+			var regs []string
+			if !arg.IsFloat() && gp < len(argReg64) {
+				regs = []string{argReg8[gp], argReg16[gp], argReg32[gp], argReg64[gp]}
+				gp++
+			} else {
+				// the arguments which don't fit in the registers are on the stack
+				// above the return address, and are copied through r11
+				fmt.Println(fmt.Sprintf("    mov r11, [rbp + %d]", 16+stack*8))
+				regs = []string{"r11b", "r11w", "r11d", "r11"}
+				stack++
+			}
+			switch arg.Size() {
 			case 1:
-				fmt.Println("    mov [rax], rsi")
+				fmt.Println(fmt.Sprintf("    mov [rax], %s", regs[0]))
 			case 2:
-				fmt.Println("    mov [rax], rdx")
-			case 3:
-				fmt.Println("    mov [rax], rcx")
+				fmt.Println(fmt.Sprintf("    mov [rax], %s", regs[1]))
 			case 4:
-				fmt.Println("    mov [rax], r8")
-			case 5:
-				fmt.Println("    mov [rax], r9")
+				fmt.Println(fmt.Sprintf("    mov [rax], %s", regs[2]))
 			default:
-				panic(fmt.Sprintf("not support args len: %d", len(n.DefineArgsOffset)))
+				fmt.Println(fmt.Sprintf("    mov [rax], %s", regs[3]))
 			}
 		}
 
 		for _, n := range n.Block {
 			gen(n)
 		}
+
+		// falling off the end returns the value of the last expression
+		fmt.Println("    pop rax")
+		fmt.Println("    mov rsp, rbp")
+		fmt.Println("    pop rbp")
+		fmt.Println("    ret")
 		return
 	case node.ND_NUM:
+		// a floating constant is pushed as its bit pattern
+		switch n.Variable.Type {
+		case vars.FloatType:
+			fmt.Println(fmt.Sprintf("    mov eax, %d", math.Float32bits(float32(n.FVal))))
+			fmt.Println("    push rax")
+			return
+		case vars.DoubleType:
+			fmt.Println(fmt.Sprintf("    movabs rax, %d", math.Float64bits(n.FVal)))
+			fmt.Println("    push rax")
+			return
+		}
+
+		if n.Val < math.MinInt32 || math.MaxInt32 < n.Val {
+			fmt.Println(fmt.Sprintf("    movabs rax, %d", n.Val))
+			fmt.Println("    push rax")
+			return
+		}
+
 		fmt.Println(fmt.Sprintf("    push %d", n.Val))
 		return
-	case node.ND_LVAR:
+	case node.ND_LVAR, node.ND_GVAR:
 		genLabel(n)
-		fmt.Println("    pop rax")
-		fmt.Println("    mov rax, [rax]")
-		fmt.Println("    push rax")
+		load(n.Variable)
+		return
+	case node.ND_DEFINE_GVAR:
+		// an initialized const global is read only
+		if n.Right != nil && n.Variable.Const {
+			fmt.Println(".section .rodata")
+		} else {
+			fmt.Println(".data")
+		}
+		if !n.Static {
+			fmt.Println(fmt.Sprintf(".global %s", n.Name))
+		}
+		fmt.Println(fmt.Sprintf(".align %d", n.Variable.Align()))
+		fmt.Println(n.Name + ":")
+		if n.Right != nil {
+			genData(n.Right)
+		} else {
+			fmt.Println(fmt.Sprintf("    .zero %d", n.Variable.Size()))
+		}
+		fmt.Println(".text")
 		return
 	case node.ND_ASSIGN:
 		genLabel(n.Left)
@@ -80,13 +149,52 @@ func gen(n *node.Node) {
 
 		fmt.Println("    pop rdi")
 		fmt.Println("    pop rax")
-		fmt.Println("    mov [rax], rdi")
+		store(n.Left.Variable)
 		fmt.Println("    push rdi")
 		return
-	case node.ND_RETURN:
-		gen(n.Right)
+	case node.ND_ASSIGN_OP, node.ND_POST_OP:
+		genLabel(n.Left)
+
+		fmt.Println("    push qword ptr [rsp]")
+		load(n.Left.Variable)
+
+		// the old value is kept as the value of x++ and x--
+		if n.Kind == node.ND_POST_OP {
+			fmt.Println("    push qword ptr [rsp]")
+		}
+
+		gen(n.Right.Right)
+
+		fmt.Println("    pop rdi")
+		fmt.Println("    pop rax")
+
+		// the left value is converted the same as in `x = x op y`
+		cast(n.Left.Variable, n.Right.Left.Variable)
+		genBinary(n.Right.Kind, n.Right.Left.Variable)
+		cast(n.Right.Variable, n.Variable)
 
+		fmt.Println("    mov rdi, rax")
+		if n.Kind == node.ND_POST_OP {
+			fmt.Println("    pop rsi")
+		}
 		fmt.Println("    pop rax")
+		store(n.Left.Variable)
+		if n.Kind == node.ND_POST_OP {
+			fmt.Println("    push rsi")
+		} else {
+			fmt.Println("    push rdi")
+		}
+		return
+	case node.ND_RETURN:
+		// return without a value in a void function
+		if n.Right != nil {
+			gen(n.Right)
+
+			fmt.Println("    pop rax")
+			if n.Right.Variable.IsFloat() {
+				fmt.Println("    movq xmm0, rax")
+			}
+		}
 		fmt.Println("    mov rsp, rbp")
 		fmt.Println("    pop rbp")
 		fmt.Println("    ret")
@@ -100,28 +208,17 @@ func gen(n *node.Node) {
 		fmt.Println("    cmp rax, 0")
 		fmt.Println(fmt.Sprintf("    je .Lend%d", end))
 
-		gen(n.Right)
+		genStmt(n.Right)
 
 		fmt.Println(fmt.Sprintf(".Lend%d:", end))
 		return
 	case node.ND_IF_ELSE:
 		gen(n.Left)
-		gen(n.Right)
+		genElse(n.Right, genStmt)
 		return
-	case node.ND_ELSE:
-		ec := getLabelCount()
-		end := getLabelCount()
-
-		fmt.Println("    pop rax")
-		fmt.Println("    cmp rax, 0")
-		fmt.Println(fmt.Sprintf("    je .Lelse%d", ec))
-
+	case node.ND_COND:
 		gen(n.Left)
-		fmt.Println(fmt.Sprintf("    jmp .Lend%d", end))
-		fmt.Println(fmt.Sprintf(".Lelse%d:", ec))
-		gen(n.Right)
-		fmt.Println(fmt.Sprintf(".Lend%d:", end))
-
+		genElse(n.Right, gen)
 		return
 	case node.ND_WHILE:
 		begin := getLabelCount()
@@ -134,56 +231,209 @@ func gen(n *node.Node) {
 		fmt.Println("    cmp rax, 0")
 		fmt.Println(fmt.Sprintf("    je .Lend%d", end))
 
-		gen(n.Right)
+		genStmt(n.Right)
+
+		fmt.Println(fmt.Sprintf("    jmp .Lbegin%d", begin))
+		fmt.Println(fmt.Sprintf(".Lend%d:", end))
+		return
+	case node.ND_FOR:
+		begin := getLabelCount()
+		end := getLabelCount()
+
+		if n.Init != nil {
+			gen(n.Init)
+			fmt.Println("    pop rax")
+		}
+
+		fmt.Println(fmt.Sprintf(".Lbegin%d:", begin))
+		if n.Left != nil {
+			gen(n.Left)
+
+			fmt.Println("    pop rax")
+			fmt.Println("    cmp rax, 0")
+			fmt.Println(fmt.Sprintf("    je .Lend%d", end))
+		}
+
+		genStmt(n.Right)
+
+		if n.Inc != nil {
+			gen(n.Inc)
+			fmt.Println("    pop rax")
+		}
 
 		fmt.Println(fmt.Sprintf("    jmp .Lbegin%d", begin))
 		fmt.Println(fmt.Sprintf(".Lend%d:", end))
 		return
+	case node.ND_COMMA:
+		gen(n.Left)
+		fmt.Println("    pop rax")
+		gen(n.Right)
+		return
 	case node.ND_BLOCK:
 		for _, n := range n.Block {
 			gen(n)
 		}
 		return
 	case node.ND_CALL_FUNC:
-		if len(n.Args) > 6 {
-			panic(fmt.Sprintf("not support args len: %d", len(n.Args)))
-		}
-
+		// all arguments are evaluated first so that a nested call can't
+		// clobber the argument registers
+		regs := make([]string, len(n.Args))
+		stack := []int{}
+		gp, fp := 0, 0
 		for i, argsNode := range n.Args {
 			gen(argsNode)
 
-			fmt.Println("    pop rax")
-
-			switch i {
-			case 0:
-				fmt.Println("    mov rdi, rax")
-			case 1:
-				fmt.Println("    mov rsi, rax")
-			case 2:
-				fmt.Println("    mov rdx, rax")
-			case 3:
-				fmt.Println("    mov rcx, rax")
-			case 4:
-				fmt.Println("    mov r8, rax")
-			case 5:
-				fmt.Println("    mov r9, rax")
+			switch {
+			case argsNode.Variable.IsFloat() && fp < argRegFloatLen:
+				regs[i] = fmt.Sprintf("xmm%d", fp)
+				fp++
+			case !argsNode.Variable.IsFloat() && gp < len(argReg64):
+				regs[i] = argReg64[gp]
+				gp++
+			default:
+				// passed on the stack
+				stack = append(stack, i)
 			}
 		}
 
+		// the callee of an indirect call is kept in r10, which isn't used for arguments
+		if n.Left != nil {
+			gen(n.Left)
+			fmt.Println("    pop r10")
+		}
+
+		// the evaluated arguments are read from rbp, which keeps rsp before the call
 		fmt.Println("    push rbp")
 		fmt.Println("    mov rbp, rsp")
-		fmt.Println(fmt.Sprintf("    call %s", n.Name))
+		arg := func(i int) string {
+			return fmt.Sprintf("[rbp + %d]", 8+(len(n.Args)-1-i)*8)
+		}
+
+		// the stack must be 16 byte aligned at the call, after the arguments
+		// which don't fit in the registers are pushed from the last one
+		fmt.Println("    and rsp, -16")
+		if len(stack)%2 == 1 {
+			fmt.Println("    sub rsp, 8")
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			fmt.Println(fmt.Sprintf("    push qword ptr %s", arg(stack[i])))
+		}
+
+		for i, reg := range regs {
+			switch {
+			case reg == "":
+			case n.Args[i].Variable.IsFloat():
+				fmt.Println(fmt.Sprintf("    movq %s, qword ptr %s", reg, arg(i)))
+			default:
+				fmt.Println(fmt.Sprintf("    mov %s, %s", reg, arg(i)))
+			}
+		}
+
+		if n.Variadic {
+			fmt.Println(fmt.Sprintf("    mov eax, %d", fp))
+		}
+		if n.Left != nil {
+			fmt.Println("    call r10")
+		} else {
+			fmt.Println(fmt.Sprintf("    call %s", n.Name))
+		}
+		fmt.Println("    mov rsp, rbp")
 		fmt.Println("    pop rbp")
+		if len(n.Args) > 0 {
+			fmt.Println(fmt.Sprintf("    add rsp, %d", len(n.Args)*8))
+		}
 
+		switch {
+		case n.Variable.Type == vars.FloatType:
+			fmt.Println("    movd eax, xmm0")
+		case n.Variable.Type == vars.DoubleType:
+			fmt.Println("    movq rax, xmm0")
+		case n.Variable.Type == vars.BoolType:
+			// only the low byte of a returned _Bool is defined
+			fmt.Println("    movzx eax, al")
+		default:
+			truncate(n.Variable)
+		}
 		fmt.Println("    push rax")
 		return
 	case node.ND_ADDR:
 		genLabel(n.Left)
 		return
+	case node.ND_FUNC_REF:
+		genLabel(n)
+		return
 	case node.ND_DEREF:
 		gen(n.Right)
+		load(n.Variable)
+		return
+	case node.ND_CAST:
+		gen(n.Right)
+
 		fmt.Println("    pop rax")
-		fmt.Println("    mov rax, [rax]")
+		cast(n.Right.Variable, n.Variable)
+		fmt.Println("    push rax")
+		return
+	case node.ND_VA_START:
+		gp, fp, stack := 0, 0, 0
+		for _, arg := range n.DefineArgs {
+			switch {
+			case arg.IsFloat() && fp < argRegFloatLen:
+				fp++
+			case !arg.IsFloat() && gp < len(argReg64):
+				gp++
+			default:
+				stack++
+			}
+		}
+
+		gen(n.Left)
+		fmt.Println("    pop rax")
+		fmt.Println(fmt.Sprintf("    mov dword ptr [rax], %d", gp*8))
+		fmt.Println(fmt.Sprintf("    mov dword ptr [rax + 4], %d", len(argReg64)*8+fp*16))
+		// the variadic arguments passed on the stack start above the return
+		// address and the named ones
+		fmt.Println(fmt.Sprintf("    lea rdi, [rbp + %d]", 16+stack*8))
+		fmt.Println("    mov [rax + 8], rdi")
+		fmt.Println("    mov rdi, rbp")
+		fmt.Println(fmt.Sprintf("    sub rdi, %d", n.VaArea.Offset))
+		fmt.Println("    mov [rax + 16], rdi")
+		fmt.Println("    push 0")
+		return
+	case node.ND_VA_ARG:
+		stack := getLabelCount()
+		end := getLabelCount()
+
+		// the offset in the register save area and its limit and step
+		field, limit, step := 0, len(argReg64)*8, 8
+		if n.Variable.IsFloat() {
+			field, limit, step = 4, len(argReg64)*8+argRegFloatLen*16, 16
+		}
+
+		gen(n.Left)
+		fmt.Println("    pop rax")
+		fmt.Println(fmt.Sprintf("    mov ecx, dword ptr [rax + %d]", field))
+		fmt.Println(fmt.Sprintf("    cmp ecx, %d", limit))
+		fmt.Println(fmt.Sprintf("    jae .Lstack%d", stack))
+		fmt.Println("    mov rdi, [rax + 16]")
+		fmt.Println("    add rdi, rcx")
+		fmt.Println(fmt.Sprintf("    add ecx, %d", step))
+		fmt.Println(fmt.Sprintf("    mov dword ptr [rax + %d], ecx", field))
+		fmt.Println(fmt.Sprintf("    jmp .Lend%d", end))
+		fmt.Println(fmt.Sprintf(".Lstack%d:", stack))
+		fmt.Println("    mov rdi, [rax + 8]")
+		fmt.Println("    lea rcx, [rdi + 8]")
+		fmt.Println("    mov [rax + 8], rcx")
+		fmt.Println(fmt.Sprintf(".Lend%d:", end))
+
+		// rdi is the address of the argument
+		fmt.Println("    push rdi")
+		load(n.Variable)
+		return
+	case node.ND_BIT_NOT:
+		gen(n.Right)
+		fmt.Println("    pop rax")
+		fmt.Println("    not rax")
+		truncate(n.Variable)
 		fmt.Println("    push rax")
 		return
 	case node.ND_DEFINE_VAR:
@@ -197,16 +447,113 @@ func gen(n *node.Node) {
 	fmt.Println("    pop rdi")
 	fmt.Println("    pop rax")
 
+	genBinary(n.Kind, n.Left.Variable)
+	truncate(n.Variable)
+
+	fmt.Println("    push rax")
+}
+
+// genStmt emits the statement n, and drops the values it leaves on the stack
+// so that a loop doesn't grow the stack on each iteration.
+func genStmt(n *node.Node) {
+	gen(n)
+
+	if c := stmtValues(n); c > 0 {
+		fmt.Println(fmt.Sprintf("    add rsp, %d", c*8))
+	}
+}
+
+// stmtValues returns the number of values the statement n leaves on the stack.
+// An expression leaves its value, and if, while, for and return leave nothing.
+func stmtValues(n *node.Node) int {
 	switch n.Kind {
+	case node.ND_BLOCK:
+		c := 0
+		for _, s := range n.Block {
+			c += stmtValues(s)
+		}
+		return c
+	case node.ND_DEFINE_VAR:
+		return stmtValues(n.Left)
+	case node.ND_IF, node.ND_IF_ELSE, node.ND_WHILE, node.ND_FOR, node.ND_RETURN:
+		return 0
+	}
+
+	return 1
+}
+
+// genElse emits the ND_ELSE n of if-else or ?: for the condition on the stack,
+// and each of the branches by genBranch.
+func genElse(n *node.Node, genBranch func(*node.Node)) {
+	ec := getLabelCount()
+	end := getLabelCount()
+
+	fmt.Println("    pop rax")
+	fmt.Println("    cmp rax, 0")
+	fmt.Println(fmt.Sprintf("    je .Lelse%d", ec))
+
+	genBranch(n.Left)
+	fmt.Println(fmt.Sprintf("    jmp .Lend%d", end))
+	fmt.Println(fmt.Sprintf(".Lelse%d:", ec))
+	genBranch(n.Right)
+	fmt.Println(fmt.Sprintf(".Lend%d:", end))
+}
+
+// genData emits the constant n, or each element of an ND_BLOCK, as data.
+func genData(n *node.Node) {
+	if n.Kind == node.ND_BLOCK {
+		for _, v := range n.Block {
+			genData(v)
+		}
+		return
+	}
+
+	v := uint64(n.Val)
+	switch n.Variable.Type {
+	case vars.FloatType:
+		v = uint64(math.Float32bits(float32(n.FVal)))
+	case vars.DoubleType:
+		v = math.Float64bits(n.FVal)
+	}
+
+	switch n.Variable.Size() {
+	case 1:
+		fmt.Println(fmt.Sprintf("    .byte %d", uint8(v)))
+	case 2:
+		fmt.Println(fmt.Sprintf("    .short %d", uint16(v)))
+	case 4:
+		fmt.Println(fmt.Sprintf("    .long %d", uint32(v)))
+	default:
+		fmt.Println(fmt.Sprintf("    .quad %d", v))
+	}
+}
+
+// genBinary emits rax = rax <op> rdi, where both operands have type t.
+func genBinary(kind node.NodeKind, t vars.Variable) {
+	if t.IsFloat() {
+		genFloatBinary(kind, t)
+		return
+	}
+
+	switch kind {
 	case node.ND_ADD:
 		fmt.Println("    add rax, rdi")
 	case node.ND_SUB:
 		fmt.Println("    sub rax, rdi")
 	case node.ND_MUL:
 		fmt.Println("    imul rax, rdi")
-	case node.ND_DIV:
-		fmt.Println("    cqo")
-		fmt.Println("    idiv rdi")
+	case node.ND_DIV, node.ND_MOD:
+		if t.Unsigned {
+			fmt.Println("    mov rdx, 0")
+			fmt.Println("    div rdi")
+		} else {
+			fmt.Println("    cqo")
+			fmt.Println("    idiv rdi")
+		}
+
+		if kind == node.ND_MOD {
+			fmt.Println("    mov rax, rdx")
+		}
 	case node.ND_EQ:
 		fmt.Println("    cmp rax, rdi")
 		fmt.Println("    sete al")
@@ -217,44 +564,288 @@ func gen(n *node.Node) {
 		fmt.Println("    movzb rax, al")
 	case node.ND_LT:
 		fmt.Println("    cmp rax, rdi")
-		fmt.Println("    setl al")
+		if t.Unsigned || t.IsPointerLike() {
+			fmt.Println("    setb al")
+		} else {
+			fmt.Println("    setl al")
+		}
 		fmt.Println("    movzb rax, al")
 	case node.ND_LE:
 		fmt.Println("    cmp rax, rdi")
-		fmt.Println("    setle al")
+		if t.Unsigned || t.IsPointerLike() {
+			fmt.Println("    setbe al")
+		} else {
+			fmt.Println("    setle al")
+		}
 		fmt.Println("    movzb rax, al")
+	case node.ND_BIT_AND:
+		fmt.Println("    and rax, rdi")
+	case node.ND_BIT_OR:
+		fmt.Println("    or rax, rdi")
+	case node.ND_BIT_XOR:
+		fmt.Println("    xor rax, rdi")
+	case node.ND_SHL:
+		fmt.Println("    mov rcx, rdi")
+		fmt.Println("    shl rax, cl")
+	case node.ND_SHR:
+		fmt.Println("    mov rcx, rdi")
+		if t.Unsigned {
+			fmt.Println("    shr rax, cl")
+		} else {
+			fmt.Println("    sar rax, cl")
+		}
 	}
+}
 
-	fmt.Println("    push rax")
+// genFloatBinary emits rax = rax <op> rdi for floating operands of type t.
+func genFloatBinary(kind node.NodeKind, t vars.Variable) {
+	sfx := floatSuffix(t)
+
+	fmt.Println("    movq xmm0, rax")
+	fmt.Println("    movq xmm1, rdi")
+
+	switch kind {
+	case node.ND_ADD:
+		fmt.Println(fmt.Sprintf("    add%s xmm0, xmm1", sfx))
+	case node.ND_SUB:
+		fmt.Println(fmt.Sprintf("    sub%s xmm0, xmm1", sfx))
+	case node.ND_MUL:
+		fmt.Println(fmt.Sprintf("    mul%s xmm0, xmm1", sfx))
+	case node.ND_DIV:
+		fmt.Println(fmt.Sprintf("    div%s xmm0, xmm1", sfx))
+	case node.ND_EQ:
+		// an unordered comparison (NaN) sets the parity flag
+		fmt.Println(fmt.Sprintf("    ucomi%s xmm0, xmm1", sfx))
+		fmt.Println("    sete al")
+		fmt.Println("    setnp dl")
+		fmt.Println("    and al, dl")
+		fmt.Println("    movzb rax, al")
+		return
+	case node.ND_NE:
+		fmt.Println(fmt.Sprintf("    ucomi%s xmm0, xmm1", sfx))
+		fmt.Println("    setne al")
+		fmt.Println("    setp dl")
+		fmt.Println("    or al, dl")
+		fmt.Println("    movzb rax, al")
+		return
+	case node.ND_LT:
+		// a < b is b > a, which is false for NaN
+		fmt.Println(fmt.Sprintf("    ucomi%s xmm1, xmm0", sfx))
+		fmt.Println("    seta al")
+		fmt.Println("    movzb rax, al")
+		return
+	case node.ND_LE:
+		fmt.Println(fmt.Sprintf("    ucomi%s xmm1, xmm0", sfx))
+		fmt.Println("    setae al")
+		fmt.Println("    movzb rax, al")
+		return
+	}
+
+	fromXmm0(t)
+}
+
+// cast converts rax of type from to type to.
+// Only rax, rdx, xmm0 and xmm1 are clobbered.
+func cast(from vars.Variable, to vars.Variable) {
+	switch {
+	case from.IsFloat() && to.IsFloat():
+		if from.Type == to.Type {
+			return
+		}
+
+		fmt.Println("    movq xmm0, rax")
+		fmt.Println(fmt.Sprintf("    cvt%s2%s xmm0, xmm0", floatSuffix(from), floatSuffix(to)))
+		fromXmm0(to)
+	case from.IsFloat() && to.Type == vars.BoolType:
+		fmt.Println("    movq xmm0, rax")
+		fmt.Println("    xorps xmm1, xmm1")
+		fmt.Println(fmt.Sprintf("    ucomi%s xmm0, xmm1", floatSuffix(from)))
+		fmt.Println("    setne al")
+		fmt.Println("    setp dl")
+		fmt.Println("    or al, dl")
+		fmt.Println("    movzx eax, al")
+	case from.IsFloat():
+		sfx := floatSuffix(from)
+		fmt.Println("    movq xmm0, rax")
+
+		if to.Unsigned && to.Size() == 8 {
+			// a value not less than 2^63 doesn't fit in a signed conversion,
+			// so 2^63 is subtracted before and the top bit is set after
+			big := getLabelCount()
+			end := getLabelCount()
+
+			if from.Type == vars.FloatType {
+				fmt.Println(fmt.Sprintf("    mov eax, %d", math.Float32bits(1<<63)))
+			} else {
+				fmt.Println(fmt.Sprintf("    movabs rax, %d", math.Float64bits(1<<63)))
+			}
+			fmt.Println("    movq xmm1, rax")
+			fmt.Println(fmt.Sprintf("    ucomi%s xmm0, xmm1", sfx))
+			fmt.Println(fmt.Sprintf("    jae .Lbig%d", big))
+			fmt.Println(fmt.Sprintf("    cvtt%s2si rax, xmm0", sfx))
+			fmt.Println(fmt.Sprintf("    jmp .Lend%d", end))
+			fmt.Println(fmt.Sprintf(".Lbig%d:", big))
+			fmt.Println(fmt.Sprintf("    sub%s xmm0, xmm1", sfx))
+			fmt.Println(fmt.Sprintf("    cvtt%s2si rax, xmm0", sfx))
+			fmt.Println("    btc rax, 63")
+			fmt.Println(fmt.Sprintf(".Lend%d:", end))
+			return
+		}
+
+		fmt.Println(fmt.Sprintf("    cvtt%s2si rax, xmm0", sfx))
+		truncate(to)
+	case to.IsFloat():
+		sfx := floatSuffix(to)
+
+		if from.Unsigned && from.Size() == 8 {
+			// a value not less than 2^63 is halved, keeping the lowest bit
+			// for rounding, and doubled after the conversion
+			neg := getLabelCount()
+			end := getLabelCount()
+
+			fmt.Println("    test rax, rax")
+			fmt.Println(fmt.Sprintf("    js .Lneg%d", neg))
+			fmt.Println(fmt.Sprintf("    cvtsi2%s xmm0, rax", sfx))
+			fmt.Println(fmt.Sprintf("    jmp .Lend%d", end))
+			fmt.Println(fmt.Sprintf(".Lneg%d:", neg))
+			fmt.Println("    mov rdx, rax")
+			fmt.Println("    shr rdx, 1")
+			fmt.Println("    and eax, 1")
+			fmt.Println("    or rdx, rax")
+			fmt.Println(fmt.Sprintf("    cvtsi2%s xmm0, rdx", sfx))
+			fmt.Println(fmt.Sprintf("    add%s xmm0, xmm0", sfx))
+			fmt.Println(fmt.Sprintf(".Lend%d:", end))
+		} else {
+			// an integer in rax is already extended to 64 bits
+			fmt.Println(fmt.Sprintf("    cvtsi2%s xmm0, rax", sfx))
+		}
+		fromXmm0(to)
+	default:
+		truncate(to)
+	}
+}
+
+// fromXmm0 moves a floating value of type t from xmm0 to rax.
+func fromXmm0(t vars.Variable) {
+	if t.Type == vars.FloatType {
+		fmt.Println("    movd eax, xmm0")
+	} else {
+		fmt.Println("    movq rax, xmm0")
+	}
+}
+
+// floatSuffix returns the SSE instruction suffix of a floating type t.
+func floatSuffix(t vars.Variable) string {
+	if t.Type == vars.FloatType {
+		return "ss"
+	}
+
+	return "sd"
 }
 
 func genLabel(n *node.Node) {
 	switch n.Kind {
 	case node.ND_LVAR:
 		fmt.Println("    mov rax, rbp")
-		fmt.Println(fmt.Sprintf("    sub rax, %d", n.Variable.Offset+n.ArrayIndex*8))
+		fmt.Println(fmt.Sprintf("    sub rax, %d", n.Variable.Offset))
 		fmt.Println("    push rax")
 	case node.ND_DEREF:
-		current := n.Right
-
-		fmt.Println("    mov rax, rbp")
-		fmt.Println(fmt.Sprintf("    sub rax, %d", current.Variable.Offset))
+		gen(n.Right)
+	case node.ND_GVAR, node.ND_FUNC_REF:
+		fmt.Println(fmt.Sprintf("    lea rax, [rip + %s]", n.Name))
 		fmt.Println("    push rax")
+	default:
+		panic(fmt.Sprintf("%d is not supported type", n.Kind))
+	}
+}
 
-		for current.Variable.IsPointerType() {
-			if err := current.Variable.Next(); err != nil {
-				panic(err)
-			}
-			fmt.Println("    pop rax")
-			fmt.Println("    mov rax, [rax]")
-			fmt.Println("    push rax")
+// load replaces the address on the top of the stack with the value of type v.
+func load(v vars.Variable) {
+	// an array is used as the address of its first element,
+	// and a function and a struct as their own address
+	if v.Type == vars.ArrayType || v.Type == vars.FuncType || v.Type == vars.StructType {
+		return
+	}
+
+	fmt.Println("    pop rax")
+	switch {
+	case v.Type == vars.CharType && !v.Unsigned:
+		fmt.Println("    movsx rax, byte ptr [rax]")
+	case v.Size() == 1:
+		fmt.Println("    movzx eax, byte ptr [rax]")
+	case v.Size() == 2 && v.Unsigned:
+		fmt.Println("    movzx eax, word ptr [rax]")
+	case v.Size() == 2:
+		fmt.Println("    movsx rax, word ptr [rax]")
+	case v.Size() == 4 && (v.Unsigned || v.IsFloat()):
+		fmt.Println("    mov eax, dword ptr [rax]")
+	case v.Size() == 4:
+		fmt.Println("    movsxd rax, dword ptr [rax]")
+	default:
+		fmt.Println("    mov rax, [rax]")
+	}
+	fmt.Println("    push rax")
+}
+
+// store writes rdi of type v to the address in rax.
+// A struct is copied from the address in rdi.
+func store(v vars.Variable) {
+	if v.Type == vars.StructType {
+		for i := 0; i < v.Size(); i++ {
+			fmt.Println(fmt.Sprintf("    mov r8b, [rdi + %d]", i))
+			fmt.Println(fmt.Sprintf("    mov [rax + %d], r8b", i))
 		}
-		// log.Println(current.Variable)
+		return
+	}
+
+	switch v.Size() {
+	case 1:
+		fmt.Println("    mov [rax], dil")
+	case 2:
+		fmt.Println("    mov [rax], di")
+	case 4:
+		fmt.Println("    mov [rax], edi")
 	default:
-		panic(fmt.Sprintf("%s is not supported type", n.Kind))
+		fmt.Println("    mov [rax], rdi")
 	}
 }
 
+// truncate makes rax a valid value of type v.
+// An integer narrower than 64 bits is kept sign or zero extended to 64 bits.
+func truncate(v vars.Variable) {
+	if !v.IsInteger() {
+		return
+	}
+
+	switch {
+	case v.Type == vars.BoolType:
+		// any non-zero value becomes 1
+		fmt.Println("    cmp rax, 0")
+		fmt.Println("    setne al")
+		fmt.Println("    movzx eax, al")
+	case v.Size() == 1 && v.Unsigned:
+		fmt.Println("    movzx eax, al")
+	case v.Size() == 1:
+		fmt.Println("    movsx rax, al")
+	case v.Size() == 2 && v.Unsigned:
+		fmt.Println("    movzx eax, ax")
+	case v.Size() == 2:
+		fmt.Println("    movsx rax, ax")
+	case v.Size() == 4 && v.Unsigned:
+		fmt.Println("    mov eax, eax")
+	case v.Size() == 4:
+		fmt.Println("    movsxd rax, eax")
+	}
+}
+
+var argReg8 = []string{"dil", "sil", "dl", "cl", "r8b", "r9b"}
+var argReg16 = []string{"di", "si", "dx", "cx", "r8w", "r9w"}
+var argReg32 = []string{"edi", "esi", "edx", "ecx", "r8d", "r9d"}
+var argReg64 = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
+
+// argRegFloatLen is the number of xmm registers used for arguments.
+const argRegFloatLen = 8
+
 var counter = 0
 
 func getLabelCount() int {
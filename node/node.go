@@ -18,16 +18,25 @@ const (
 	ND_SUB
 	ND_DEREF
 	ND_ADDR
+	ND_CAST
 	ND_MUL
 	ND_DIV
+	ND_MOD
 	ND_LVAR
+	ND_GVAR // a variable with static storage
 	ND_NUM
 	ND_FUNC      // func()
-	ND_CALL_FUNC // call func()
+	ND_CALL_FUNC // call func(), or call Left() when Left is not nil
+	ND_FUNC_REF  // func as a value
+	ND_VA_START  // va_start(Left, ...)
+	ND_VA_ARG    // va_arg(Left, Variable)
 
 	ND_DEFINE_VAR
+	ND_DEFINE_GVAR
 
 	ND_ASSIGN
+	ND_ASSIGN_OP // +=, -=, ..., Right is the operation applied to Left
+	ND_POST_OP   // x++, x--, the same as ND_ASSIGN_OP but evaluated to the old Left
 
 	ND_GT // > , but not use
 	ND_GE // >=, but not use
@@ -36,652 +45,2387 @@ const (
 	ND_EQ // ==
 	ND_NE // !=
 
+	ND_BIT_AND // &
+	ND_BIT_OR  // |
+	ND_BIT_XOR // ^
+	ND_BIT_NOT // ~
+	ND_SHL     // <<
+	ND_SHR     // >>
+
 	ND_RETURN  // return
 	ND_IF      // if
 	ND_ELSE    // else
 	ND_IF_ELSE // if & else
+	ND_COND    // ? :
 	ND_WHILE   // while
+	ND_FOR     // for
 
 	ND_BLOCK // {}
+
+	ND_COMMA // ,
 )
 
 type Node struct {
-	Kind             NodeKind
-	Left             *Node
-	Right            *Node
-	Block            []*Node
-	Val              int
-	Variable         vars.Variable
-	ArrayIndex       int
-	Name             string
-	Args             []*Node
-	DefineArgsOffset []int
+	Kind       NodeKind
+	Left       *Node
+	Right      *Node
+	Block      []*Node
+	Val        int
+	FVal       float64
+	Variable   vars.Variable
+	Name       string
+	Args       []*Node
+	DefineArgs []vars.Variable
+	StackSize  int
+
+	// for (Init; Left; Inc) Right
+	Init *Node
+	Inc  *Node
+
+	// register save area of a variadic function, used by ND_FUNC and ND_VA_START
+	VaArea *vars.Variable
+
+	// Static is set on ND_FUNC and ND_DEFINE_GVAR of a symbol local to the file
+	Static bool
+
+	// Variadic is set on ND_CALL_FUNC when the callee may take variable arguments,
+	// which needs al to be the number of vector registers used
+	Variadic bool
 }
 
 func (n Node) IsNum() bool {
 	return n.Kind == ND_NUM
 }
 
+func (n Node) IsLvalue() bool {
+	return n.Kind == ND_LVAR || n.Kind == ND_GVAR || n.Kind == ND_DEREF
+}
+
 func NewNode(kind NodeKind, left *Node, right *Node) *Node {
+	switch kind {
+	case ND_ADD, ND_SUB, ND_MUL, ND_DIV, ND_MOD,
+		ND_EQ, ND_NE, ND_LT, ND_LE,
+		ND_BIT_AND, ND_BIT_OR, ND_BIT_XOR:
+		left, right = usualArithConv(left, right)
+	case ND_SHL, ND_SHR:
+		left, right = promote(left), promote(right)
+	case ND_BIT_NOT:
+		right = promote(right)
+	}
+
 	node := Node{
 		Kind:  kind,
 		Left:  left,
 		Right: right,
 	}
+	node.Variable = typeOf(&node)
 
 	return &node
 }
 
-func NewNodeFunc(name string, block []*Node, args []int) *Node {
+func NewNodeAssignOp(kind NodeKind, left *Node, right *Node) *Node {
 	node := Node{
-		Kind:             ND_FUNC,
-		Name:             name,
-		Block:            block,
-		DefineArgsOffset: args,
+		Kind:     ND_ASSIGN_OP,
+		Left:     left,
+		Right:    NewNode(kind, left, right),
+		Variable: left.Variable,
 	}
 
 	return &node
 }
 
-func NewNodeBlock(block []*Node) *Node {
+// NewNodePostOp returns x++ or x-- as `x += right` or `x -= right`, which is
+// evaluated to the value of x before it is updated.
+func NewNodePostOp(kind NodeKind, left *Node, right *Node) *Node {
+	node := NewNodeAssignOp(kind, left, right)
+	node.Kind = ND_POST_OP
+
+	return node
+}
+
+func NewNodeCast(t vars.Variable, right *Node) *Node {
+	// Functions are implicitly declared to return int. A cast to a pointer applied
+	// to the call directly is taken as its return type so that `(int *)malloc(n)`
+	// keeps the whole pointer.
+	if right.Kind == ND_CALL_FUNC && t.IsPointerType() {
+		if _, ok := functions[right.Name]; !ok {
+			right.Variable = t
+		}
+	}
+
 	node := Node{
-		Kind:  ND_BLOCK,
-		Block: block,
+		Kind:     ND_CAST,
+		Right:    right,
+		Variable: t,
 	}
 
 	return &node
 }
 
-func NewNodeNum(n int) *Node {
+func NewNodeFunc(name string, block []*Node, args []vars.Variable, vaArea *vars.Variable, stackSize int) *Node {
 	node := Node{
-		Kind: ND_NUM,
-		Val:  n,
+		Kind:       ND_FUNC,
+		Name:       name,
+		Block:      block,
+		DefineArgs: args,
+		StackSize:  stackSize,
+		VaArea:     vaArea,
 	}
 
 	return &node
 }
 
-func NewNodeLVar(v vars.Variable) *Node {
+// NewNodeVaStart returns va_start(ap) in a variadic function with the named
+// parameters args.
+func NewNodeVaStart(ap *Node, args []vars.Variable, vaArea *vars.Variable) *Node {
 	node := Node{
-		Kind:     ND_LVAR,
-		Variable: v,
+		Kind:       ND_VA_START,
+		Left:       ap,
+		DefineArgs: args,
+		VaArea:     vaArea,
+		Variable:   intType,
 	}
 
 	return &node
 }
 
-func NewNodeCallFunc(name string, args []*Node) *Node {
+func NewNodeVaArg(ap *Node, t vars.Variable) *Node {
 	node := Node{
-		Kind: ND_CALL_FUNC,
-		Name: name,
-		Args: args,
+		Kind:     ND_VA_ARG,
+		Left:     ap,
+		Variable: t,
 	}
 
 	return &node
 }
 
-type NodeParser struct {
-	token *token.Token
+func NewNodeFor(init *Node, cond *Node, inc *Node, body *Node) *Node {
+	node := Node{
+		Kind:  ND_FOR,
+		Left:  cond,
+		Right: body,
+		Init:  init,
+		Inc:   inc,
+	}
+
+	return &node
 }
 
-func NewNodeParser(token *token.Token) *NodeParser {
-	np := NodeParser{
-		token: token,
+func NewNodeBlock(block []*Node) *Node {
+	node := Node{
+		Kind:  ND_BLOCK,
+		Block: block,
 	}
 
-	return &np
+	return &node
 }
 
-func (np *NodeParser) Program() ([]*Node, error) {
-	result := []*Node{}
-	for !np.token.IsEOF() {
-		if err := np.token.ConsumeReserved("int"); err != nil {
-			return nil, errors.WithStack(err)
-		}
-
-		name, err := np.token.ConsumeIndent()
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-		if err := np.token.ConsumeReserved("("); err != nil {
-			return nil, errors.WithStack(err)
-		}
+func NewNodeNum(n int) *Node {
+	return NewNodeNumType(n, intType)
+}
 
-		args := []int{}
-		first := true
-		for !np.token.Expect(")") {
-			if first {
-				first = false
-			} else {
-				if err := np.token.ConsumeReserved(","); err != nil {
-					return nil, errors.WithStack(err)
-				}
-			}
+func NewNodeNumType(n int, t vars.Variable) *Node {
+	node := Node{
+		Kind:     ND_NUM,
+		Val:      n,
+		Variable: t,
+	}
 
-			if err := np.token.ConsumeReserved("int"); err != nil {
-				return nil, errors.WithStack(err)
-			}
+	return &node
+}
 
-			name, err := np.token.ConsumeIndent()
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+func NewNodeFloat(f float64, t vars.Variable) *Node {
+	node := Node{
+		Kind:     ND_NUM,
+		FVal:     f,
+		Variable: t,
+	}
 
-			if _, ok := locals.Get(name); ok {
-				return nil, util.CompileError{
-					Input:   np.token.GetInput(),
-					Message: fmt.Sprintf("%s is already defined.", name),
-					Pos:     np.token.GetPos(),
-				}
-			}
-			locals.Set(vars.NewVariable(name, vars.IntType))
-			variable, _ := locals.Get(name)
+	return &node
+}
 
-			args = append(args, variable.Offset)
-		}
+func NewNodeLVar(v vars.Variable) *Node {
+	node := Node{
+		Kind:     ND_LVAR,
+		Variable: v,
+	}
 
-		if err := np.token.ConsumeReserved(")"); err != nil {
-			return nil, errors.WithStack(err)
-		}
-		if err := np.token.ConsumeReserved("{"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	return &node
+}
 
-		block := []*Node{}
-		for !np.token.Expect("}") {
-			node, err := np.Stmt()
-			if err != nil {
-				return nil, err
-			}
-			block = append(block, node)
-		}
+func NewNodeGVar(v vars.Variable) *Node {
+	node := Node{
+		Kind:     ND_GVAR,
+		Name:     v.Label,
+		Variable: v,
+	}
 
-		if err := np.token.ConsumeReserved("}"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	return &node
+}
 
-		funcNode := NewNodeFunc(name, block, args)
-		result = append(result, funcNode)
+// NewNodeGVarDef returns the definition of a global v. init is its initial value
+// folded to ND_NUM, or nil.
+func NewNodeGVarDef(v vars.Variable, static bool, init *Node) *Node {
+	node := Node{
+		Kind:     ND_DEFINE_GVAR,
+		Name:     v.Label,
+		Variable: v,
+		Static:   static,
+		Right:    init,
 	}
-	return result, nil
+
+	return &node
 }
 
-func (np *NodeParser) Stmt() (*Node, error) {
-	if np.token.Expect("{") {
-		if err := np.token.ConsumeReserved("{"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+func NewNodeCallFunc(name string, args []*Node) *Node {
+	// an undefined function is implicitly declared to return int,
+	// and may be variadic like printf
+	fn, ok := functions[name]
+	if !ok {
+		fn = vars.FuncOf(intType, nil)
+		fn.Variadic = true
+	}
 
-		block := []*Node{}
-		for !np.token.Expect("}") {
-			node, err := np.Stmt()
-			if err != nil {
-				return nil, err
-			}
+	node := newCall(fn, args)
+	node.Name = name
 
-			block = append(block, node)
-		}
+	return node
+}
 
-		if err := np.token.ConsumeReserved("}"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+// NewNodeCallPtr returns a call through callee, an expression of the function type fn
+// or a pointer to it.
+func NewNodeCallPtr(callee *Node, fn vars.Variable, args []*Node) *Node {
+	node := newCall(fn, args)
+	node.Left = callee
 
-		return NewNodeBlock(block), nil
-	}
+	return node
+}
 
-	if np.token.Expect("return") {
-		if err := np.token.ConsumeReserved("return"); err != nil {
-			return nil, errors.WithStack(err)
+func newCall(fn vars.Variable, args []*Node) *Node {
+	for i, arg := range args {
+		if i < len(fn.Params) {
+			args[i] = convert(arg, fn.Params[i])
+		} else {
+			args[i] = defaultPromote(arg)
 		}
+	}
 
-		node, err := np.Expr()
-		if err != nil {
-			return nil, err
-		}
+	node := Node{
+		Kind:     ND_CALL_FUNC,
+		Args:     args,
+		Variable: *fn.Return,
+		Variadic: fn.Variadic,
+	}
 
-		if err := np.token.ConsumeReserved(";"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	return &node
+}
 
-		return NewNode(ND_RETURN, nil, node), nil
+// NewNodeFuncRef returns a function designator, which is evaluated to the
+// address of the function.
+func NewNodeFuncRef(name string, fn vars.Variable) *Node {
+	node := Node{
+		Kind:     ND_FUNC_REF,
+		Name:     name,
+		Variable: fn,
 	}
 
-	if np.token.Expect("if") {
-		if err := np.token.ConsumeReserved("if"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	return &node
+}
 
-		if err := np.token.ConsumeReserved("("); err != nil {
-			return nil, errors.WithStack(err)
-		}
+type NodeParser struct {
+	token      *token.Token
+	returnType vars.Variable
 
-		node1, err := np.Expr()
-		if err != nil {
-			return nil, err
-		}
+	// the name, the parameters and the register save area of the current function
+	funcName string
+	params   []vars.Variable
+	vaArea   *vars.Variable
 
-		if err := np.token.ConsumeReserved(")"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	// definitions of the static local variables in the current function
+	statics []*Node
 
-		ifNode, err := np.Stmt()
-		if err != nil {
-			return nil, err
-		}
+	// a global is defined once even if it is declared again,
+	// and a function declared static stays local to the file
+	defined  map[string]*Node
+	internal map[string]bool
 
-		if np.token.Expect("else") {
-			if err := np.token.ConsumeReserved("else"); err != nil {
-				return nil, errors.WithStack(err)
-			}
+	// MaxErrors is the number of errors reported before giving up, or 0 for no limit.
+	MaxErrors int
+	errors    util.ErrorList
+}
 
-			elseNode, err := np.Stmt()
-			if err != nil {
-				return nil, err
-			}
+func NewNodeParser(token *token.Token) *NodeParser {
+	np := NodeParser{
+		token:     token,
+		defined:   map[string]*Node{},
+		internal:  map[string]bool{},
+		MaxErrors: defaultMaxErrors,
+	}
 
-			ifNode = NewNode(ND_ELSE, ifNode, elseNode)
-			return NewNode(ND_IF_ELSE, node1, ifNode), nil
-		}
+	return &np
+}
 
-		return NewNode(ND_IF, node1, ifNode), nil
+// defaultMaxErrors is the default of NodeParser.MaxErrors.
+const defaultMaxErrors = 20
+
+// errTooManyErrors stops the parser when MaxErrors errors have been reported.
+var errTooManyErrors = errors.New("too many errors")
+
+// recoverFrom records err, and skips to the end of the statement or declaration
+// in which it occurred so that the errors after it are reported too. It returns
+// errTooManyErrors when the parser should stop.
+func (np *NodeParser) recoverFrom(err error, topLevel bool) error {
+	if errors.Cause(err) == errTooManyErrors {
+		return err
 	}
 
-	if np.token.Expect("while") {
-		if err := np.token.ConsumeReserved("while"); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	np.errors = append(np.errors, err)
+	if np.MaxErrors > 0 && len(np.errors) >= np.MaxErrors {
+		np.errors = append(np.errors, fmt.Errorf("too many errors, stopping after %d", len(np.errors)))
+		return errTooManyErrors
+	}
 
-		if err := np.token.ConsumeReserved("("); err != nil {
-			return nil, errors.WithStack(err)
-		}
+	np.synchronize(topLevel)
+	return nil
+}
 
-		node, err := np.Expr()
-		if err != nil {
-			return nil, err
+// synchronize skips tokens past the next `;` or a block opened while skipping.
+// It stops at the `}` closing the enclosing block, which is left to its parser,
+// but skips such a stray `}` at the top level.
+func (np *NodeParser) synchronize(topLevel bool) {
+	depth := 0
+	for !np.token.IsEOF() {
+		end := false
+		switch {
+		case np.token.Expect(";"):
+			end = depth == 0
+		case np.token.Expect("{"):
+			depth++
+		case np.token.Expect("}"):
+			if depth == 0 && !topLevel {
+				return
+			}
+			depth--
+			end = depth <= 0
 		}
 
-		if err := np.token.ConsumeReserved(")"); err != nil {
-			return nil, errors.WithStack(err)
+		if err := np.token.Consume(); err != nil || end {
+			return
 		}
+	}
+}
 
-		s, err := np.Stmt()
+// Program parses the whole input. It goes on after an error to report all of them,
+// up to MaxErrors, as util.ErrorList.
+func (np *NodeParser) Program() ([]*Node, error) {
+	result := []*Node{}
+	for !np.token.IsEOF() {
+		nodes, err := np.ExternalDecl()
 		if err != nil {
-			return nil, err
+			if err := np.recoverFrom(err, true); err != nil {
+				break
+			}
+			continue
 		}
+		result = append(result, nodes...)
+	}
+
+	if len(np.errors) > 0 {
+		return nil, np.errors
+	}
+	return result, nil
+}
 
-		return NewNode(ND_WHILE, node, s), nil
+// ExternalDecl parses a declaration or a function definition at the top level,
+// and returns the definitions in it.
+func (np *NodeParser) ExternalDecl() ([]*Node, error) {
+	if err := np.skipExtension(); err != nil {
+		return nil, err
 	}
 
-	if np.token.Expect("int") {
-		if err := np.token.ConsumeReserved("int"); err != nil {
+	if np.token.Expect(";") {
+		if err := np.token.ConsumeReserved(";"); err != nil {
 			return nil, errors.WithStack(err)
 		}
+		return nil, nil
+	}
 
-		head := vars.Variable{}
-		current := &head
-		isPointerType := false
-		for np.token.Expect("*") {
-			if err := np.token.Consume(); err != nil {
-				return nil, errors.WithStack(err)
-			}
-			isPointerType = true
-
-			next := vars.Variable{}
-			current.Type = vars.PointerType
-			current.Pointer = &next
-			current = &next
-		}
+	spec, ok, err := np.declSpecs()
+	if err != nil || !ok {
+		return nil, err
+	}
 
-		name, err := np.token.ConsumeIndent()
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+	start := *np.token
+	returnType, name, err := np.declaratorRest(spec.base, true)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		_, err := np.token.ConsumeIndent()
+		return nil, errors.WithStack(err)
+	}
 
-		if _, ok := locals.Get(name); ok {
-			return nil, util.CompileError{
-				Input:   np.token.GetInput(),
-				Message: fmt.Sprintf("%s is already defined.", name),
-				Pos:     np.token.GetPos(),
+	if !np.token.Expect("(") {
+		nodes := []*Node{}
+		for {
+			variable, init, err := np.GlobalVar(returnType, name)
+			if err != nil {
+				return nil, err
 			}
-		}
 
-		if np.token.Expect("[") {
-			err := np.token.ConsumeReserved("[")
+			def, err := np.defineGlobal(start, variable, init, spec.static, spec.extern)
 			if err != nil {
-				return nil, errors.WithStack(err)
+				return nil, err
+			}
+			if def != nil {
+				nodes = append(nodes, def)
 			}
 
-			n, err := np.token.ConsumeNumber()
-			if err != nil {
+			if !np.token.Expect(",") {
+				break
+			}
+			if err := np.token.ConsumeReserved(","); err != nil {
 				return nil, errors.WithStack(err)
 			}
 
-			err = np.token.ConsumeReserved("]")
+			start = *np.token
+			returnType, name, err = np.declaratorRest(spec.base, true)
 			if err != nil {
-				return nil, errors.WithStack(err)
+				return nil, err
 			}
-
-			head = vars.Variable{
-				Name:      name,
-				Type:      vars.ArrayType,
-				ArraySize: n,
+			if name == "" {
+				_, err := np.token.ConsumeIndent()
+				return nil, errors.WithStack(err)
 			}
-		} else if isPointerType {
-			head.Name = name
-			current.Type = vars.IntType
-		} else {
-			head = vars.NewVariable(name, vars.IntType)
 		}
-		locals.Set(head)
 
 		if err := np.token.ConsumeReserved(";"); err != nil {
 			return nil, errors.WithStack(err)
 		}
-
-		node, err := np.Stmt()
-		if err != nil {
-			return nil, err
-		}
-
-		return NewNode(ND_DEFINE_VAR, node, nil), nil
+		return nodes, nil
 	}
 
-	node, err := np.Expr()
+	np.returnType = returnType
+	np.funcName = name
+	np.statics = nil
+	np.internal[name] = np.internal[name] || spec.static
+
+	params, variadic, err := np.ParamTypes()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := np.token.ConsumeReserved(";"); err != nil {
-		return nil, errors.WithStack(err)
+	fn := vars.FuncOf(returnType, params)
+	fn.Variadic = variadic
+	functions[name] = fn
+
+	// a prototype only declares the type of the function
+	if np.token.Expect(";") {
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return nil, nil
 	}
 
-	return node, nil
-}
+	// the variables of a function are visible only in its body, and its frame
+	// holds only them
+	locals = vars.NewLocalVariales()
+	defer func() {
+		locals = vars.NewLocalVariales()
+	}()
+
+	args := []vars.Variable{}
+	seen := map[string]bool{}
+	for _, arg := range params {
+		if arg.Name == "" {
+			return nil, np.token.NewTokenError(util.EmptyVarName, "parameter name omitted in the definition of %s", name)
+		}
 
-func (np *NodeParser) Expr() (*Node, error) {
-	return np.Assign()
-}
+		if seen[arg.Name] {
+			return nil, np.token.NewTokenError(util.RedefinedError, "%s is already defined.", arg.Name)
+		}
+		seen[arg.Name] = true
+		locals.Set(arg)
+		variable, _ := locals.Get(arg.Name)
 
-func (np *NodeParser) Assign() (*Node, error) {
-	node, err := np.Equality()
-	if err != nil {
-		return nil, err
+		args = append(args, variable)
 	}
 
-	if np.token.Expect("=") {
-		err = np.token.ConsumeReserved("=")
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+	np.params = args
+	np.vaArea = nil
+	if variadic {
+		// the name can't collide with a C identifier
+		area := vars.ArrayOf(longType, vaAreaSize/8)
+		area.Name = "va_area." + name
+		locals.Set(area)
+		v, _ := locals.Get(area.Name)
+		np.vaArea = &v
+	}
 
-		right, err := np.Assign()
+	if err := np.token.ConsumeReserved("{"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	block := []*Node{}
+	for !np.token.Expect("}") && !np.token.IsEOF() {
+		node, err := np.Stmt()
 		if err != nil {
-			return nil, err
+			if err := np.recoverFrom(err, false); err != nil {
+				return nil, err
+			}
+			continue
 		}
-		node = NewNode(ND_ASSIGN, node, right)
+		block = append(block, node)
 	}
 
-	return node, nil
+	if err := np.token.ConsumeReserved("}"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	funcNode := NewNodeFunc(name, block, args, np.vaArea, locals.StackSize())
+	funcNode.Static = np.internal[name]
+	return append([]*Node{funcNode}, np.statics...), nil
 }
 
-func (np *NodeParser) Equality() (*Node, error) {
-	node, err := np.Relational()
+// GlobalVar parses the initializer of a global variable of the type t,
+// and returns the variable and its initial value if any.
+func (np *NodeParser) GlobalVar(t vars.Variable, name string) (vars.Variable, *Node, error) {
+	t.Name = name
+	t.Label = name
+	globals[name] = t
+
+	init, err := np.staticInit(t)
 	if err != nil {
-		return nil, err
+		return vars.Variable{}, nil, err
 	}
 
-	for {
-		if np.token.Expect("==") {
-			err := np.token.ConsumeReserved("==")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	return t, init, nil
+}
 
-			right, err := np.Relational()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_EQ, node, right)
-			continue
-		}
+// staticInit parses the initializer, if any, of the variable t with static storage,
+// and returns its constant value.
+func (np *NodeParser) staticInit(t vars.Variable) (*Node, error) {
+	if !np.token.Expect("=") {
+		return nil, nil
+	}
+	if err := np.token.ConsumeReserved("="); err != nil {
+		return nil, errors.WithStack(err)
+	}
 
-		if np.token.Expect("!=") {
-			err := np.token.ConsumeReserved("!=")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	start := *np.token
+	node, err := np.Conditional()
+	if err != nil {
+		return nil, err
+	}
 
-			right, err := np.Relational()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_NE, node, right)
-			continue
-		}
+	if t.Type == vars.ArrayType {
+		return nil, start.NewTokenError(util.NotConstantError, "initializer of array %s is not supported", t.Name)
+	}
 
-		return node, nil
+	node = convert(node, t)
+	i, f, ok := evalConst(node)
+	if !ok {
+		return nil, start.NewTokenError(util.NotConstantError, "initializer of %s is not a constant", t.Name)
+	}
+
+	if t.IsFloat() {
+		return NewNodeFloat(f, t), nil
 	}
+	return NewNodeNumType(i, t), nil
 }
 
-func (np *NodeParser) Relational() (*Node, error) {
-	node, err := np.Add()
-	if err != nil {
-		return nil, err
+// defineGlobal records a declaration of the global variable v declared at op,
+// and returns its definition when v is defined for the first time.
+func (np *NodeParser) defineGlobal(op token.Token, v vars.Variable, init *Node, static bool, extern bool) (*Node, error) {
+	// extern with an initializer is a definition
+	if extern && init == nil {
+		return nil, nil
 	}
 
-	for {
-		if np.token.Expect("<") {
-			err := np.token.ConsumeReserved("<")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	if v.Type == vars.StructType && !v.Struct.Complete {
+		return nil, op.NewTokenError(util.InvalidTypeError, "storage size of %s isn't known", v.Name)
+	}
 
-			right, err := np.Add()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_LT, node, right)
-			continue
+	def, ok := np.defined[v.Name]
+	if !ok {
+		def = NewNodeGVarDef(v, static, init)
+		np.defined[v.Name] = def
+		return def, nil
+	}
+
+	if init != nil {
+		if def.Right != nil {
+			return nil, op.NewTokenError(util.RedefinedError, "%s is already defined.", v.Name)
 		}
+		def.Right = init
+	}
 
-		if np.token.Expect("<=") {
-			err := np.token.ConsumeReserved("<=")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	return nil, nil
+}
 
-			right, err := np.Add()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_LE, node, right)
-			continue
+// Typedef parses the declarators following `typedef base`, e.g. `T, *PT;`
+// of `typedef int T, *PT;`, and defines them as type names.
+func (np *NodeParser) Typedef(base vars.Variable) error {
+	for {
+		t, name, err := np.declaratorRest(base, true)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			_, err := np.token.ConsumeIndent()
+			return errors.WithStack(err)
 		}
 
-		if np.token.Expect(">") {
-			err := np.token.ConsumeReserved(">")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-
-			right, err := np.Add()
+		// a function type as in `typedef int F(int);`
+		if np.token.Expect("(") {
+			params, variadic, err := np.ParamTypes()
 			if err != nil {
-				return nil, err
+				return err
 			}
-			node = NewNode(ND_LT, right, node)
-			continue
+			t = vars.FuncOf(t, params)
+			t.Variadic = variadic
 		}
 
-		if np.token.Expect(">=") {
-			err := np.token.ConsumeReserved(">=")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+		typedefs[name] = t
 
-			right, err := np.Add()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_LE, right, node)
-			continue
+		if !np.token.Expect(",") {
+			break
+		}
+		if err := np.token.ConsumeReserved(","); err != nil {
+			return errors.WithStack(err)
 		}
+	}
 
-		return node, nil
+	return errors.WithStack(np.token.ConsumeReserved(";"))
+}
+
+// skipExtension skips __extension__, which only silences the warnings of GNU
+// extensions.
+func (np *NodeParser) skipExtension() error {
+	for np.token.Expect("__extension__") {
+		if err := np.token.Consume(); err != nil {
+			return errors.WithStack(err)
+		}
 	}
+	return nil
 }
 
-func (np *NodeParser) Add() (*Node, error) {
-	node, err := np.Mul()
+// declSpec is the storage class and the base type of a declaration.
+type declSpec struct {
+	base   vars.Variable
+	static bool
+	extern bool
+}
+
+// declSpecs parses the storage class and the specifiers of a declaration. It
+// reports false when the declaration ends with them, as a declaration of a
+// struct, union or enum only or a typedef.
+func (np *NodeParser) declSpecs() (declSpec, bool, error) {
+	static, extern, typedef, err := np.StorageClass()
 	if err != nil {
-		return nil, err
+		return declSpec{}, false, err
 	}
 
-	for {
-		if np.token.Expect("+") {
-			err := np.token.ConsumeReserved("+")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	base, err := np.DeclSpec()
+	if err != nil {
+		return declSpec{}, false, err
+	}
 
-			right, err := np.Mul()
-			if err != nil {
-				return nil, err
-			}
-			if node.Variable.Type == vars.PointerType {
-				right.Val *= 4
-			}
-			node = NewNode(ND_ADD, node, right)
-			continue
+	// a declaration of a struct, union or enum only
+	if np.token.Expect(";") {
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return declSpec{}, false, errors.WithStack(err)
 		}
+		return declSpec{}, false, nil
+	}
 
-		if np.token.Expect("-") {
-			err := np.token.ConsumeReserved("-")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-
-			right, err := np.Mul()
-			if err != nil {
-				return nil, err
-			}
-			if node.Variable.Type == vars.PointerType {
-				right.Val *= 4
-			}
-			node = NewNode(ND_SUB, node, right)
-			continue
+	if typedef {
+		if err := np.Typedef(base); err != nil {
+			return declSpec{}, false, err
 		}
-
-		return node, nil
+		return declSpec{}, false, nil
 	}
+
+	return declSpec{base: base, static: static, extern: extern}, true, nil
 }
 
-func (np *NodeParser) Mul() (*Node, error) {
-	node, err := np.Unary()
-	if err != nil {
-		return nil, err
+// StorageClass parses `static`, `extern` or `typedef` if present.
+func (np *NodeParser) StorageClass() (bool, bool, bool, error) {
+	static, extern, typedef := false, false, false
+	for np.isStorageClass(np.token) {
+		spec := *np.token
+		switch {
+		case spec.Expect("static"):
+			static = true
+		case spec.Expect("extern"):
+			extern = true
+		default:
+			typedef = true
+		}
+
+		if err := np.token.Consume(); err != nil {
+			return false, false, false, errors.WithStack(err)
+		}
+
+		if boolInt(static)+boolInt(extern)+boolInt(typedef) > 1 {
+			return false, false, false, spec.NewTokenError(util.InvalidTypeError, "multiple storage classes: %+v", &spec)
+		}
 	}
 
-	for {
-		if np.token.Expect("*") {
-			err := np.token.ConsumeReserved("*")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
+	return static, extern, typedef, nil
+}
 
-			right, err := np.Unary()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_MUL, node, right)
-			continue
+func (np *NodeParser) isStorageClass(t *token.Token) bool {
+	return t != nil && (t.Expect("static") || t.Expect("extern") || t.Expect("typedef"))
+}
+
+func (np *NodeParser) Stmt() (*Node, error) {
+	if np.token.Expect("{") {
+		if err := np.token.ConsumeReserved("{"); err != nil {
+			return nil, errors.WithStack(err)
 		}
 
-		if np.token.Expect("/") {
-			err := np.token.ConsumeReserved("/")
+		block := []*Node{}
+		for !np.token.Expect("}") && !np.token.IsEOF() {
+			node, err := np.Stmt()
 			if err != nil {
-				return nil, errors.WithStack(err)
+				if err := np.recoverFrom(err, false); err != nil {
+					return nil, err
+				}
+				continue
 			}
 
-			right, err := np.Unary()
-			if err != nil {
-				return nil, err
-			}
-			node = NewNode(ND_DIV, node, right)
+			block = append(block, node)
 		}
 
-		return node, nil
+		if err := np.token.ConsumeReserved("}"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		return NewNodeBlock(block), nil
 	}
-}
 
-func (np *NodeParser) Unary() (*Node, error) {
-	if np.token.Expect("sizeof") {
-		err := np.token.ConsumeReserved("sizeof")
-		if err != nil {
+	if np.token.Expect("return") {
+		if err := np.token.ConsumeReserved("return"); err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		right, err := np.Unary()
+		if np.token.Expect(";") {
+			if err := np.token.ConsumeReserved(";"); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return NewNode(ND_RETURN, nil, nil), nil
+		}
+
+		node, err := np.Expr()
 		if err != nil {
 			return nil, err
 		}
 
-		switch right.Variable.Type {
-		case vars.PointerType:
-			return NewNodeNum(8), nil
-		case vars.ArrayType:
-			return NewNodeNum(right.Variable.ArraySize * 4), nil
-		default:
-			return NewNodeNum(4), nil
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return nil, errors.WithStack(err)
 		}
-	}
 
-	err := np.token.ConsumeReserved("+")
-	if err == nil {
-		return np.Primary()
+		return NewNode(ND_RETURN, nil, convert(node, np.returnType)), nil
 	}
 
-	if np.token.Expect("-") {
-		err = np.token.ConsumeReserved("-")
-		if err != nil {
+	if np.token.Expect("if") {
+		if err := np.token.ConsumeReserved("if"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if err := np.token.ConsumeReserved("("); err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		right, err := np.Primary()
+		node1, err := np.Expr()
 		if err != nil {
 			return nil, err
 		}
-		return NewNode(ND_SUB, NewNodeNum(0), right), nil
-	}
 
-	if np.token.Expect("*") {
-		err = np.token.ConsumeReserved("*")
-		if err != nil {
+		if err := np.token.ConsumeReserved(")"); err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		right, err := np.Unary()
+		ifNode, err := np.Stmt()
 		if err != nil {
 			return nil, err
 		}
 
-		return NewNode(ND_DEREF, nil, right), nil
-	}
-
-	if np.token.Expect("&") {
-		err = np.token.ConsumeReserved("&")
+		if np.token.Expect("else") {
+			if err := np.token.ConsumeReserved("else"); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			elseNode, err := np.Stmt()
+			if err != nil {
+				return nil, err
+			}
+
+			ifNode = NewNode(ND_ELSE, ifNode, elseNode)
+			return NewNode(ND_IF_ELSE, condition(node1), ifNode), nil
+		}
+
+		return NewNode(ND_IF, condition(node1), ifNode), nil
+	}
+
+	if np.token.Expect("while") {
+		if err := np.token.ConsumeReserved("while"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if err := np.token.ConsumeReserved("("); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		node, err := np.Expr()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := np.token.ConsumeReserved(")"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		s, err := np.Stmt()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(ND_WHILE, condition(node), s), nil
+	}
+
+	if np.token.Expect("for") {
+		if err := np.token.ConsumeReserved("for"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if err := np.token.ConsumeReserved("("); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var init, cond, inc *Node
+		var err error
+		if !np.token.Expect(";") {
+			init, err = np.Expr()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !np.token.Expect(";") {
+			cond, err = np.Expr()
+			if err != nil {
+				return nil, err
+			}
+			cond = condition(cond)
+		}
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !np.token.Expect(")") {
+			inc, err = np.Expr()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := np.token.ConsumeReserved(")"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		s, err := np.Stmt()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNodeFor(init, cond, inc, s), nil
+	}
+
+	if err := np.skipExtension(); err != nil {
+		return nil, err
+	}
+
+	if np.isTypeName(np.token) || np.isStorageClass(np.token) {
+		spec, ok, err := np.declSpecs()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return NewNodeBlock([]*Node{}), nil
+		}
+
+		for {
+			start := *np.token
+			variable, name, err := np.declaratorRest(spec.base, true)
+			if err != nil {
+				return nil, err
+			}
+			if name == "" {
+				_, err := np.token.ConsumeIndent()
+				return nil, errors.WithStack(err)
+			}
+			variable.Name = name
+
+			if variable.Type == vars.StructType && !variable.Struct.Complete && !spec.extern {
+				return nil, start.NewTokenError(util.InvalidTypeError, "storage size of %s isn't known", name)
+			}
+
+			if _, ok := locals.Get(variable.Name); ok {
+				return nil, start.NewTokenError(util.RedefinedError, "%s is already defined.", variable.Name)
+			}
+
+			switch {
+			case spec.extern:
+				if np.token.Expect("=") {
+					return nil, np.token.NewTokenError(util.InvalidTypeError, "extern variable %s has an initializer", name)
+				}
+				variable.Label = variable.Name
+				locals.Declare(variable)
+			case spec.static:
+				// the label is scoped by the function so that it doesn't collide with a global
+				variable.Label = np.funcName + "." + variable.Name
+				locals.Declare(variable)
+
+				init, err := np.staticInit(variable)
+				if err != nil {
+					return nil, err
+				}
+				np.statics = append(np.statics, NewNodeGVarDef(variable, true, init))
+			default:
+				locals.Set(variable)
+			}
+
+			if !np.token.Expect(",") {
+				break
+			}
+			if err := np.token.ConsumeReserved(","); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		node, err := np.Stmt()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(ND_DEFINE_VAR, node, nil), nil
+	}
+
+	node, err := np.Expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := np.token.ConsumeReserved(";"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) Expr() (*Node, error) {
+	node, err := np.Assign()
+	if err != nil {
+		return nil, err
+	}
+
+	for np.token.Expect(",") {
+		if err := np.token.ConsumeReserved(","); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Assign()
+		if err != nil {
+			return nil, err
+		}
+		node = NewNode(ND_COMMA, node, right)
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) Assign() (*Node, error) {
+	node, err := np.Conditional()
+	if err != nil {
+		return nil, err
+	}
+
+	if np.token.Expect("=") {
+		op := *np.token
+		err = np.token.ConsumeReserved("=")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !node.IsLvalue() {
+			return nil, op.NewTokenError(util.NotLvalueError, "left side of = is not assignable")
+		}
+		if err := checkConst(op, "=", node); err != nil {
+			return nil, err
+		}
+
+		right, err := np.Assign()
+		if err != nil {
+			return nil, err
+		}
+		node = NewNode(ND_ASSIGN, node, convert(right, node.Variable))
+		return node, nil
+	}
+
+	for _, v := range []struct {
+		op   string
+		kind NodeKind
+	}{
+		{"+=", ND_ADD},
+		{"-=", ND_SUB},
+		{"*=", ND_MUL},
+		{"/=", ND_DIV},
+		{"%=", ND_MOD},
+		{"&=", ND_BIT_AND},
+		{"|=", ND_BIT_OR},
+		{"^=", ND_BIT_XOR},
+		{"<<=", ND_SHL},
+		{">>=", ND_SHR},
+	} {
+		if !np.token.Expect(v.op) {
+			continue
+		}
+
+		op := *np.token
+		err = np.token.ConsumeReserved(v.op)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !node.IsLvalue() {
+			return nil, op.NewTokenError(util.NotLvalueError, "left side of %s is not assignable", v.op)
+		}
+		if err := checkConst(op, v.op, node); err != nil {
+			return nil, err
+		}
+
+		right, err := np.Assign()
+		if err != nil {
+			return nil, err
+		}
+		switch v.kind {
+		case ND_MOD, ND_BIT_AND, ND_BIT_OR, ND_BIT_XOR, ND_SHL, ND_SHR:
+			if err := checkInteger(op, v.op, node, right); err != nil {
+				return nil, err
+			}
+		}
+		if (v.kind == ND_DIV || v.kind == ND_MOD) && divByZero(node, right) {
+			return nil, op.NewTokenError(util.DivisionByZeroError, "division by zero")
+		}
+		if v.kind == ND_ADD || v.kind == ND_SUB {
+			right = scalePointer(node, right)
+		}
+
+		return NewNodeAssignOp(v.kind, node, right), nil
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) Conditional() (*Node, error) {
+	node, err := np.BitOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !np.token.Expect("?") {
+		return node, nil
+	}
+
+	op := *np.token
+	if err := np.token.ConsumeReserved("?"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	then, err := np.Expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := np.token.ConsumeReserved(":"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	els, err := np.Conditional()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkCond(op, then, els); err != nil {
+		return nil, err
+	}
+
+	then, els = usualArithConv(then, els)
+	return NewNode(ND_COND, condition(node), NewNode(ND_ELSE, then, els)), nil
+}
+
+func (np *NodeParser) BitOr() (*Node, error) {
+	node, err := np.BitXor()
+	if err != nil {
+		return nil, err
+	}
+
+	for np.token.Expect("|") {
+		op := *np.token
+		err := np.token.ConsumeReserved("|")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.BitXor()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkInteger(op, "|", node, right); err != nil {
+			return nil, err
+		}
+		node = NewNode(ND_BIT_OR, node, right)
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) BitXor() (*Node, error) {
+	node, err := np.BitAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for np.token.Expect("^") {
+		op := *np.token
+		err := np.token.ConsumeReserved("^")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.BitAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkInteger(op, "^", node, right); err != nil {
+			return nil, err
+		}
+		node = NewNode(ND_BIT_XOR, node, right)
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) BitAnd() (*Node, error) {
+	node, err := np.Equality()
+	if err != nil {
+		return nil, err
+	}
+
+	for np.token.Expect("&") {
+		op := *np.token
+		err := np.token.ConsumeReserved("&")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Equality()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkInteger(op, "&", node, right); err != nil {
+			return nil, err
+		}
+		node = NewNode(ND_BIT_AND, node, right)
+	}
+
+	return node, nil
+}
+
+func (np *NodeParser) Equality() (*Node, error) {
+	node, err := np.Relational()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("==") {
+			err := np.token.ConsumeReserved("==")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Relational()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_EQ, node, right)
+			continue
+		}
+
+		if np.token.Expect("!=") {
+			err := np.token.ConsumeReserved("!=")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Relational()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_NE, node, right)
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (np *NodeParser) Relational() (*Node, error) {
+	node, err := np.Shift()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("<") {
+			err := np.token.ConsumeReserved("<")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Shift()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_LT, node, right)
+			continue
+		}
+
+		if np.token.Expect("<=") {
+			err := np.token.ConsumeReserved("<=")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Shift()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_LE, node, right)
+			continue
+		}
+
+		if np.token.Expect(">") {
+			err := np.token.ConsumeReserved(">")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Shift()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_LT, right, node)
+			continue
+		}
+
+		if np.token.Expect(">=") {
+			err := np.token.ConsumeReserved(">=")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Shift()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_LE, right, node)
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (np *NodeParser) Shift() (*Node, error) {
+	node, err := np.Add()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("<<") {
+			op := *np.token
+			err := np.token.ConsumeReserved("<<")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Add()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkInteger(op, "<<", node, right); err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_SHL, node, right)
+			continue
+		}
+
+		if np.token.Expect(">>") {
+			op := *np.token
+			err := np.token.ConsumeReserved(">>")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Add()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkInteger(op, ">>", node, right); err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_SHR, node, right)
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (np *NodeParser) Add() (*Node, error) {
+	node, err := np.Mul()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("+") {
+			err := np.token.ConsumeReserved("+")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Mul()
+			if err != nil {
+				return nil, err
+			}
+			node = newAdd(node, right)
+			continue
+		}
+
+		if np.token.Expect("-") {
+			err := np.token.ConsumeReserved("-")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Mul()
+			if err != nil {
+				return nil, err
+			}
+			node = newSub(node, right)
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (np *NodeParser) Mul() (*Node, error) {
+	node, err := np.Unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("*") {
+			err := np.token.ConsumeReserved("*")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Unary()
+			if err != nil {
+				return nil, err
+			}
+			node = NewNode(ND_MUL, node, right)
+			continue
+		}
+
+		if np.token.Expect("/") {
+			op := *np.token
+			err := np.token.ConsumeReserved("/")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Unary()
+			if err != nil {
+				return nil, err
+			}
+			if divByZero(node, right) {
+				return nil, op.NewTokenError(util.DivisionByZeroError, "division by zero")
+			}
+			node = NewNode(ND_DIV, node, right)
+			continue
+		}
+
+		if np.token.Expect("%") {
+			op := *np.token
+			err := np.token.ConsumeReserved("%")
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			right, err := np.Unary()
+			if err != nil {
+				return nil, err
+			}
+			if err := checkInteger(op, "%", node, right); err != nil {
+				return nil, err
+			}
+			if divByZero(node, right) {
+				return nil, op.NewTokenError(util.DivisionByZeroError, "modulo by zero")
+			}
+			node = NewNode(ND_MOD, node, right)
+			continue
+		}
+
+		return node, nil
+	}
+}
+
+func (np *NodeParser) Unary() (*Node, error) {
+	if err := np.skipExtension(); err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"sizeof", "_Alignof"} {
+		if !np.token.Expect(op) {
+			continue
+		}
+
+		start := *np.token
+		err := np.token.ConsumeReserved(op)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		t, err := np.typeOrExpr()
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == vars.FuncType {
+			return nil, start.NewTokenError(util.InvalidTypeError, "%s applied to a function", op)
+		}
+		if t.Type == vars.StructType && !t.Struct.Complete {
+			return nil, start.NewTokenError(util.InvalidTypeError, "%s applied to an incomplete type", op)
+		}
+
+		if op == "sizeof" {
+			return NewNodeNumType(t.Size(), ulongType), nil
+		}
+		return NewNodeNumType(t.Align(), ulongType), nil
+	}
+
+	if np.token.Expect("(") && np.isTypeName(np.token.Peek()) {
+		if err := np.token.ConsumeReserved("("); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		t, err := np.TypeName()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := np.token.ConsumeReserved(")"); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNodeCast(t, right), nil
+	}
+
+	for _, v := range []struct {
+		op   string
+		kind NodeKind
+	}{
+		{"++", ND_ADD},
+		{"--", ND_SUB},
+	} {
+		if !np.token.Expect(v.op) {
+			continue
+		}
+
+		op := *np.token
+		if err := np.token.ConsumeReserved(v.op); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		node, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+		if !node.IsLvalue() {
+			return nil, op.NewTokenError(util.NotLvalueError, "operand of %s is not assignable", v.op)
+		}
+		if err := checkConst(op, v.op, node); err != nil {
+			return nil, err
+		}
+
+		return NewNodeAssignOp(v.kind, node, scalePointer(node, NewNodeNum(1))), nil
+	}
+
+	err := np.token.ConsumeReserved("+")
+	if err == nil {
+		return np.Unary()
+	}
+
+	if np.token.Expect("-") {
+		err = np.token.ConsumeReserved("-")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+		return NewNode(ND_SUB, NewNodeNum(0), right), nil
+	}
+
+	if np.token.Expect("*") {
+		err = np.token.ConsumeReserved("*")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(ND_DEREF, nil, right), nil
+	}
+
+	if np.token.Expect("~") {
+		op := *np.token
+		err = np.token.ConsumeReserved("~")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		right, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkInteger(op, "~", right); err != nil {
+			return nil, err
+		}
+
+		return NewNode(ND_BIT_NOT, nil, promote(right)), nil
+	}
+
+	if np.token.Expect("&") {
+		err = np.token.ConsumeReserved("&")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		left, err := np.Unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewNode(ND_ADDR, left, nil), nil
+	}
+
+	return np.Postfix()
+}
+
+// typeOrExpr parses the operand of sizeof, either `(type-name)` or a unary
+// expression, and returns its type. The expression is never evaluated.
+func (np *NodeParser) typeOrExpr() (vars.Variable, error) {
+	if np.token.Expect("(") && np.isTypeName(np.token.Peek()) {
+		if err := np.token.ConsumeReserved("("); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+
+		t, err := np.TypeName()
+		if err != nil {
+			return vars.Variable{}, err
+		}
+
+		if err := np.token.ConsumeReserved(")"); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+		return t, nil
+	}
+
+	node, err := np.Unary()
+	if err != nil {
+		return vars.Variable{}, err
+	}
+
+	return node.Variable, nil
+}
+
+// TypeName parses a type without a variable name, e.g. `int *` in a cast.
+func (np *NodeParser) TypeName() (vars.Variable, error) {
+	t, _, err := np.declarator(false)
+	return t, err
+}
+
+// DeclSpec parses a sequence of type specifiers such as `unsigned long int`,
+// a struct, union or enum specifier, or a typedef name.
+func (np *NodeParser) DeclSpec() (vars.Variable, error) {
+	if !np.isTypeName(np.token) {
+		return vars.Variable{}, np.token.NewTokenError(util.NotTypeError, "current is not type: %+v", np.token)
+	}
+
+	count := map[string]int{}
+	// the type given by a struct, union or enum specifier or a typedef name
+	var base *vars.Variable
+	isConst, isVolatile := false, false
+	for np.isTypeName(np.token) {
+		spec := *np.token
+
+		// an identifier names a type only when no other type is given,
+		// otherwise it is the declared name as in `typedef int T; long T;`
+		if name, ok := spec.Ident(); ok {
+			if base != nil || len(count) > 0 {
+				break
+			}
+			t := typedefs[name]
+			base = &t
+			if err := np.token.Consume(); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+			continue
+		}
+
+		if np.isAttribute(&spec) {
+			if err := np.attributes(); err != nil {
+				return vars.Variable{}, err
+			}
+			continue
+		}
+
+		if np.isQualifier(&spec) {
+			isConst = isConst || spec.Expect("const")
+			isVolatile = isVolatile || spec.Expect("volatile")
+			if err := np.token.Consume(); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+			continue
+		}
+
+		// function specifiers don't change the type
+		if np.isFuncSpecifier(&spec) {
+			if err := np.token.Consume(); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+			continue
+		}
+
+		if base != nil {
+			return vars.Variable{}, spec.NewTokenError(util.InvalidTypeError, "invalid type specifier: %+v", &spec)
+		}
+
+		if spec.Expect("struct") || spec.Expect("union") || spec.Expect("enum") {
+			if len(count) > 0 {
+				return vars.Variable{}, spec.NewTokenError(util.InvalidTypeError, "invalid type specifier: %+v", &spec)
+			}
+
+			var t vars.Variable
+			var err error
+			if spec.Expect("enum") {
+				t, err = np.enumSpec()
+			} else {
+				t, err = np.structSpec()
+			}
+			if err != nil {
+				return vars.Variable{}, err
+			}
+			base = &t
+			continue
+		}
+
+		for _, v := range typeSpecifiers {
+			if spec.Expect(v) {
+				count[v]++
+			}
+		}
+		if err := np.token.Consume(); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+
+		if count["int"] > 1 || count["short"] > 1 || count["long"] > 2 ||
+			count["signed"] > 1 || count["unsigned"] > 1 || count["char"] > 1 ||
+			(count["short"] > 0 && count["long"] > 0) ||
+			(count["signed"] > 0 && count["unsigned"] > 0) ||
+			(count["_Bool"] > 0 && len(count) > 1) ||
+			(count["void"] > 0 && len(count) > 1) ||
+			(count["char"] > 0 && len(count) > count["signed"]+count["unsigned"]+1) ||
+			(count["__builtin_va_list"] > 0 && len(count) > 1) ||
+			(count["float"] > 0 && len(count) > 1) ||
+			(count["double"] > 0 && len(count) > 1 && !(len(count) == 2 && count["long"] == 1)) {
+			return vars.Variable{}, spec.NewTokenError(util.InvalidTypeError, "invalid type specifier: %+v", &spec)
+		}
+	}
+
+	if base != nil {
+		t := *base
+		t.Const, t.Volatile = t.Const || isConst, t.Volatile || isVolatile
+		return t, nil
+	}
+
+	if count["__builtin_va_list"] > 0 {
+		t := vaListType
+		t.Const, t.Volatile = isConst, isVolatile
+		return t, nil
+	}
+
+	t := vars.NewVariable("", vars.IntType)
+	switch {
+	case count["void"] > 0:
+		t.Type = vars.VoidType
+	case count["char"] > 0:
+		t.Type = vars.CharType
+	case count["float"] > 0:
+		t.Type = vars.FloatType
+	case count["double"] > 0:
+		// long double is the same as double
+		t.Type = vars.DoubleType
+	case count["_Bool"] > 0:
+		t.Type = vars.BoolType
+	case count["short"] > 0:
+		t.Type = vars.ShortType
+	case count["long"] > 0:
+		// long long is the same as long
+		t.Type = vars.LongType
+	}
+	t.Unsigned = count["unsigned"] > 0
+	t.Const, t.Volatile = isConst, isVolatile
+
+	return t, nil
+}
+
+// structSpec parses a struct or union specifier such as `struct tag { int a; long b; }`,
+// `union { int i; float f; }` or `struct tag`, which may refer to a struct completed later.
+func (np *NodeParser) structSpec() (vars.Variable, error) {
+	union := np.token.Expect("union")
+	if err := np.token.Consume(); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+	if err := np.attributes(); err != nil {
+		return vars.Variable{}, err
+	}
+
+	op := *np.token
+	tag, named := np.token.Ident()
+	if named {
+		if err := np.token.Consume(); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+	}
+
+	s, ok := tags[tag]
+	if !named || !ok {
+		s = &vars.Struct{Tag: tag, Union: union}
+		if named {
+			tags[tag] = s
+		}
+	}
+	t := vars.Variable{Type: vars.StructType, Struct: s}
+
+	if !np.token.Expect("{") {
+		if !named {
+			return vars.Variable{}, np.token.NewTokenError(util.NotTypeError, "struct without a tag or members: %+v", np.token)
+		}
+		return t, nil
+	}
+
+	if s.Complete {
+		return vars.Variable{}, op.NewTokenError(util.InvalidTypeError, "redefinition of %s", tag)
+	}
+
+	if err := np.token.ConsumeReserved("{"); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+
+	members := []vars.Variable{}
+	for !np.token.Expect("}") {
+		if err := np.skipExtension(); err != nil {
+			return vars.Variable{}, err
+		}
+
+		base, err := np.DeclSpec()
+		if err != nil {
+			return vars.Variable{}, err
+		}
+
+		// a struct or union without a name is an anonymous member
+		if np.token.Expect(";") && base.Type == vars.StructType {
+			if err := np.token.ConsumeReserved(";"); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+			members = append(members, base)
+			continue
+		}
+
+		for {
+			m, name, err := np.declaratorRest(base, true)
+			if err != nil {
+				return vars.Variable{}, err
+			}
+			if name == "" {
+				_, err := np.token.ConsumeIndent()
+				return vars.Variable{}, errors.WithStack(err)
+			}
+			if np.token.Expect(":") {
+				return vars.Variable{}, np.token.NewTokenError(util.InvalidTypeError, "bit-field %s is not supported", name)
+			}
+			if m.Type == vars.StructType && !m.Struct.Complete {
+				return vars.Variable{}, np.token.NewTokenError(util.InvalidTypeError, "field %s has incomplete type", name)
+			}
+
+			m.Name = name
+			members = append(members, m)
+
+			if !np.token.Expect(",") {
+				break
+			}
+			if err := np.token.ConsumeReserved(","); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+		}
+
+		if err := np.token.ConsumeReserved(";"); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+	}
+
+	if err := np.token.ConsumeReserved("}"); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+
+	s.Define(members)
+	if err := np.attributes(); err != nil {
+		return vars.Variable{}, err
+	}
+
+	return t, nil
+}
+
+// enumSpec parses an enum specifier such as `enum color { RED, GREEN = 3 }` or
+// `enum color`. The constants are int, and so is the enum itself.
+func (np *NodeParser) enumSpec() (vars.Variable, error) {
+	if err := np.token.ConsumeReserved("enum"); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+	if err := np.attributes(); err != nil {
+		return vars.Variable{}, err
+	}
+
+	if _, ok := np.token.Ident(); ok {
+		if err := np.token.Consume(); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+	}
+
+	if !np.token.Expect("{") {
+		return intType, nil
+	}
+	if err := np.token.ConsumeReserved("{"); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+
+	v := 0
+	for !np.token.Expect("}") {
+		name, err := np.token.ConsumeIndent()
+		if err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+
+		if np.token.Expect("=") {
+			if err := np.token.ConsumeReserved("="); err != nil {
+				return vars.Variable{}, errors.WithStack(err)
+			}
+
+			start := *np.token
+			node, err := np.Conditional()
+			if err != nil {
+				return vars.Variable{}, err
+			}
+
+			i, _, ok := evalConst(node)
+			if !ok || !node.Variable.IsInteger() {
+				return vars.Variable{}, start.NewTokenError(util.NotConstantError, "value of %s is not an integer constant", name)
+			}
+			v = i
+		}
+
+		enums[name] = v
+		v++
+
+		if !np.token.Expect(",") {
+			break
+		}
+		if err := np.token.ConsumeReserved(","); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+	}
+
+	if err := np.token.ConsumeReserved("}"); err != nil {
+		return vars.Variable{}, errors.WithStack(err)
+	}
+
+	return intType, nil
+}
+
+// Declarator parses a variable definition such as `int *a[3]` or `int (*f)(int)`.
+func (np *NodeParser) Declarator() (vars.Variable, error) {
+	t, name, err := np.declarator(true)
+	if err != nil {
+		return vars.Variable{}, err
+	}
+
+	if name == "" {
+		_, err := np.token.ConsumeIndent()
+		return vars.Variable{}, errors.WithStack(err)
+	}
+
+	t.Name = name
+	return t, nil
+}
+
+// declarator parses a type and, if named is true and it is present, the declared name.
+func (np *NodeParser) declarator(named bool) (vars.Variable, string, error) {
+	t, err := np.DeclSpec()
+	if err != nil {
+		return vars.Variable{}, "", err
+	}
+
+	return np.declaratorRest(t, named)
+}
+
+// declaratorRest parses the pointers, the name and the array lengths which follow
+// the type specifiers t, e.g. `*const p[2][3]` of `int *const p[2][3]`.
+func (np *NodeParser) declaratorRest(t vars.Variable, named bool) (vars.Variable, string, error) {
+	for np.token.Expect("*") {
+		if err := np.token.ConsumeReserved("*"); err != nil {
+			return vars.Variable{}, "", errors.WithStack(err)
+		}
+		var err error
+		t, err = np.qualifiers(vars.PointerTo(t))
+		if err != nil {
+			return vars.Variable{}, "", err
+		}
+	}
+
+	if np.token.Expect("(") && np.token.Peek() != nil && np.token.Peek().Expect("*") {
+		return np.funcPointer(t, named)
+	}
+
+	name := ""
+	if named {
+		if ident, ok := np.token.Ident(); ok {
+			name = ident
+			if err := np.token.Consume(); err != nil {
+				return vars.Variable{}, "", errors.WithStack(err)
+			}
+		}
+	}
+
+	dims, err := np.arrayLens()
+	if err != nil {
+		return vars.Variable{}, "", err
+	}
+	for i := len(dims) - 1; i >= 0; i-- {
+		t = vars.ArrayOf(t, dims[i])
+	}
+
+	if err := np.attributes(); err != nil {
+		return vars.Variable{}, "", err
+	}
+
+	return t, name, nil
+}
+
+// funcPointer parses the rest of a pointer to a function returning ret,
+// e.g. `(*f)(int, long)` or `(*ops[4])(int)`.
+func (np *NodeParser) funcPointer(ret vars.Variable, named bool) (vars.Variable, string, error) {
+	if err := np.token.ConsumeReserved("("); err != nil {
+		return vars.Variable{}, "", errors.WithStack(err)
+	}
+
+	// the qualifiers of each pointer from the innermost
+	pointers := []vars.Variable{}
+	for np.token.Expect("*") {
+		if err := np.token.ConsumeReserved("*"); err != nil {
+			return vars.Variable{}, "", errors.WithStack(err)
+		}
+		q, err := np.qualifiers(vars.Variable{})
+		if err != nil {
+			return vars.Variable{}, "", err
+		}
+		pointers = append(pointers, q)
+	}
+
+	name := ""
+	if named && !np.token.Expect(")") && !np.token.Expect("[") {
+		var err error
+		name, err = np.token.ConsumeIndent()
+		if err != nil {
+			return vars.Variable{}, "", errors.WithStack(err)
+		}
+	}
+
+	dims, err := np.arrayLens()
+	if err != nil {
+		return vars.Variable{}, "", err
+	}
+
+	if err := np.token.ConsumeReserved(")"); err != nil {
+		return vars.Variable{}, "", errors.WithStack(err)
+	}
+
+	params, variadic, err := np.ParamTypes()
+	if err != nil {
+		return vars.Variable{}, "", err
+	}
+
+	t := vars.FuncOf(ret, params)
+	t.Variadic = variadic
+	for _, q := range pointers {
+		t = vars.PointerTo(t)
+		t.Const, t.Volatile = q.Const, q.Volatile
+	}
+	for i := len(dims) - 1; i >= 0; i-- {
+		t = vars.ArrayOf(t, dims[i])
+	}
+
+	if err := np.attributes(); err != nil {
+		return vars.Variable{}, "", err
+	}
+
+	return t, name, nil
+}
+
+// ParamTypes parses the parameter list of a function type such as `(int a, long *, ...)`,
+// and reports whether it ends with `...`. `(void)` is an empty list.
+func (np *NodeParser) ParamTypes() ([]vars.Variable, bool, error) {
+	if err := np.token.ConsumeReserved("("); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	if np.token.Expect("void") && np.token.Peek() != nil && np.token.Peek().Expect(")") {
+		if err := np.token.ConsumeReserved("void"); err != nil {
+			return nil, false, errors.WithStack(err)
+		}
+	}
+
+	params := []vars.Variable{}
+	variadic := false
+	for !np.token.Expect(")") {
+		if len(params) > 0 {
+			if err := np.token.ConsumeReserved(","); err != nil {
+				return nil, false, errors.WithStack(err)
+			}
+		}
+
+		if np.token.Expect("...") {
+			if err := np.token.ConsumeReserved("..."); err != nil {
+				return nil, false, errors.WithStack(err)
+			}
+			variadic = true
+			break
+		}
+
+		t, name, err := np.declarator(true)
 		if err != nil {
+			return nil, false, err
+		}
+
+		// a parameter declared as an array or a function is a pointer
+		switch t.Type {
+		case vars.ArrayType:
+			t = vars.PointerTo(*t.Pointer)
+		case vars.FuncType:
+			t = vars.PointerTo(t)
+		}
+
+		t.Name = name
+		params = append(params, t)
+	}
+
+	if err := np.token.ConsumeReserved(")"); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	if err := np.attributes(); err != nil {
+		return nil, false, err
+	}
+
+	return params, variadic, nil
+}
+
+// arrayLens parses the lengths of `[n][m]...` if present. The length is a constant
+// expression, and is 0 when omitted as in `int a[]`.
+func (np *NodeParser) arrayLens() ([]int, error) {
+	dims := []int{}
+	for np.token.Expect("[") {
+		if err := np.token.ConsumeReserved("["); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		n := 0
+		if !np.token.Expect("]") {
+			start := *np.token
+			node, err := np.Conditional()
+			if err != nil {
+				return nil, err
+			}
+
+			i, _, ok := evalConst(node)
+			if !ok || !node.Variable.IsInteger() {
+				return nil, start.NewTokenError(util.NotConstantError, "array length is not an integer constant")
+			}
+			if i < 0 {
+				return nil, start.NewTokenError(util.InvalidTypeError, "array length is negative")
+			}
+			n = i
+		}
+
+		if err := np.token.ConsumeReserved("]"); err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		left, err := np.Unary()
-		if err != nil {
-			return nil, err
+		dims = append(dims, n)
+	}
+
+	return dims, nil
+}
+
+func (np *NodeParser) isTypeName(t *token.Token) bool {
+	if t == nil {
+		return false
+	}
+
+	for _, v := range typeSpecifiers {
+		if t.Expect(v) {
+			return true
+		}
+	}
+	return t.Expect("struct") || t.Expect("union") || t.Expect("enum") ||
+		np.isQualifier(t) || np.isFuncSpecifier(t) || np.isAttribute(t) || np.isTypedef(t)
+}
+
+// isTypedef reports whether t is a typedef name not hidden by a variable.
+func (np *NodeParser) isTypedef(t *token.Token) bool {
+	name, ok := t.Ident()
+	if !ok {
+		return false
+	}
+
+	if _, ok := locals.Get(name); ok {
+		return false
+	}
+	_, ok = typedefs[name]
+	return ok
+}
+
+func (np *NodeParser) isQualifier(t *token.Token) bool {
+	return t.Expect("const") || t.Expect("volatile") ||
+		t.Expect("restrict") || t.Expect("__restrict") || t.Expect("__restrict__")
+}
+
+func (np *NodeParser) isFuncSpecifier(t *token.Token) bool {
+	return t.Expect("inline") || t.Expect("__inline") || t.Expect("__inline__") ||
+		t.Expect("_Noreturn")
+}
+
+func (np *NodeParser) isAttribute(t *token.Token) bool {
+	return t.Expect("__attribute__") || t.Expect("__attribute") || t.Expect("__asm__") || t.Expect("__asm")
+}
+
+// attributes skips GNU attributes such as `__attribute__ ((__nothrow__))` and
+// asm labels such as `__asm__ ("" "name")`, which don't change the generated code.
+func (np *NodeParser) attributes() error {
+	for np.isAttribute(np.token) {
+		if err := np.token.Consume(); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := np.token.ConsumeReserved("("); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for depth := 1; depth > 0; {
+			if np.token.IsEOF() {
+				return np.token.NewTokenError(util.NotReserverdError, "unterminated attribute")
+			}
+			if np.token.Expect("(") {
+				depth++
+			}
+			if np.token.Expect(")") {
+				depth--
+			}
+			if err := np.token.Consume(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// qualifiers applies the qualifiers following `*` to the pointer t.
+func (np *NodeParser) qualifiers(t vars.Variable) (vars.Variable, error) {
+	for np.isQualifier(np.token) || np.isAttribute(np.token) {
+		if np.isAttribute(np.token) {
+			if err := np.attributes(); err != nil {
+				return vars.Variable{}, err
+			}
+			continue
+		}
+
+		t.Const = t.Const || np.token.Expect("const")
+		t.Volatile = t.Volatile || np.token.Expect("volatile")
+		if err := np.token.Consume(); err != nil {
+			return vars.Variable{}, errors.WithStack(err)
+		}
+	}
+
+	return t, nil
+}
+
+var typeSpecifiers = []string{
+	"int", "short", "long", "unsigned", "signed", "_Bool", "float", "double",
+	"void", "char", "__builtin_va_list",
+}
+
+func (np *NodeParser) Postfix() (*Node, error) {
+	node, err := np.Primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if np.token.Expect("(") {
+			op := *np.token
+			args, err := np.Args()
+			if err != nil {
+				return nil, err
+			}
+
+			fn := node.Variable
+			if fn.IsPointerType() {
+				fn = *fn.Pointer
+			}
+			if fn.Type != vars.FuncType {
+				return nil, op.NewTokenError(util.NotFunctionError, "called object is not a function: %s", node.Variable.Type)
+			}
+
+			node = NewNodeCallPtr(node, fn, args)
+			if err := checkCall(op, node); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if np.token.Expect(".") || np.token.Expect("->") {
+			op := *np.token
+			if err := np.token.Consume(); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			name, err := np.token.ConsumeIndent()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			// p->m is (*p).m
+			if op.Expect("->") {
+				if !node.Variable.IsPointerLike() {
+					return nil, op.NewTokenError(util.InvalidOperandError, "operand of -> is not a pointer: %s", node.Variable.Type)
+				}
+				node = NewNode(ND_DEREF, nil, node)
+			}
+
+			node, err = member(op, node, name)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if np.token.Expect("[") {
+			if err := np.token.ConsumeReserved("["); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			index, err := np.Expr()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := np.token.ConsumeReserved("]"); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			// a[i] is *(a + i)
+			node = NewNode(ND_DEREF, nil, newAdd(node, index))
+			continue
+		}
+
+		if np.token.Expect("++") {
+			op := *np.token
+			if err := np.token.ConsumeReserved("++"); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if !node.IsLvalue() {
+				return nil, op.NewTokenError(util.NotLvalueError, "operand of ++ is not assignable")
+			}
+			if err := checkConst(op, "++", node); err != nil {
+				return nil, err
+			}
+
+			node = NewNodePostOp(ND_ADD, node, scalePointer(node, NewNodeNum(1)))
+			continue
+		}
+
+		if np.token.Expect("--") {
+			op := *np.token
+			if err := np.token.ConsumeReserved("--"); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if !node.IsLvalue() {
+				return nil, op.NewTokenError(util.NotLvalueError, "operand of -- is not assignable")
+			}
+			if err := checkConst(op, "--", node); err != nil {
+				return nil, err
+			}
+
+			node = NewNodePostOp(ND_SUB, node, scalePointer(node, NewNodeNum(1)))
+			continue
 		}
 
-		return NewNode(ND_ADDR, left, nil), nil
+		return node, nil
 	}
-
-	return np.Primary()
 }
 
 func (np *NodeParser) Primary() (*Node, error) {
@@ -704,79 +2448,709 @@ func (np *NodeParser) Primary() (*Node, error) {
 		return node, nil
 	}
 
+	if np.token.IsString() {
+		// adjacent string literals are concatenated
+		str := ""
+		for np.token.IsString() {
+			s, err := np.token.ConsumeString()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			str += s
+		}
+
+		return np.stringLiteral(str), nil
+	}
+
+	if np.token.IsFloat() {
+		t := doubleType
+		if np.token.IsFloat32() {
+			t = floatType
+		}
+
+		f, err := np.token.ConsumeFloat()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return NewNodeFloat(f, t), nil
+	}
+
+	unsigned, long := np.token.IsUnsigned(), np.token.IsLong()
 	n, err := np.token.ConsumeNumber()
 	if err == nil {
-		return NewNodeNum(n), errors.WithStack(err)
+		return NewNodeNumType(n, numberType(unsigned, long)), errors.WithStack(err)
 	}
 
+	op := *np.token
 	name, err := np.token.ConsumeIndent()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if np.token.Expect("(") {
-		err = np.token.ConsumeReserved("(")
+	switch name {
+	case "va_start", "__builtin_va_start":
+		return np.vaStart(&op)
+	case "va_arg", "__builtin_va_arg":
+		return np.vaArg()
+	case "va_end", "__builtin_va_end":
+		// nothing to release
+		args, err := np.Args()
 		if err != nil {
-			return nil, errors.WithStack(err)
+			return nil, err
 		}
+		if len(args) != 1 {
+			return nil, op.NewTokenError(util.InvalidOperandError, "va_end takes 1 argument, but %d", len(args))
+		}
+		return NewNode(ND_COMMA, args[0], NewNodeNum(0)), nil
+	}
 
-		args := []*Node{}
-		first := true
-		for !np.token.Expect(")") {
-			if first {
-				first = false
-			} else {
-				if err := np.token.ConsumeReserved(","); err != nil {
-					return nil, errors.WithStack(err)
-				}
-			}
+	variable, ok := locals.Get(name)
+	if !ok {
+		variable, ok = globals[name]
+	}
 
-			argsNode, err := np.Expr()
-			if err != nil {
+	// a variable holding a function pointer is called in Postfix
+	if np.token.Expect("(") && !ok {
+		args, err := np.Args()
+		if err != nil {
+			return nil, err
+		}
+
+		node := NewNodeCallFunc(name, args)
+		if err := checkCall(op, node); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	if v, isEnum := enums[name]; isEnum && !ok {
+		return NewNodeNum(v), nil
+	}
+
+	if fn, isFunc := functions[name]; isFunc && !ok {
+		return NewNodeFuncRef(name, fn), nil
+	}
+
+	if !ok {
+		return nil, op.NewTokenError(util.NotVariableError, "%s is not defined.", name)
+	}
+
+	if variable.Label != "" {
+		return NewNodeGVar(variable), nil
+	}
+	return NewNodeLVar(variable), nil
+}
+
+// stringLiteral returns an anonymous array of char holding str with the
+// terminating NUL, and defines it at the end of the current function.
+func (np *NodeParser) stringLiteral(str string) *Node {
+	t := vars.ArrayOf(charType, len(str)+1)
+	t.Label = fmt.Sprintf(".L.str.%d", literals)
+	t.Name = t.Label
+	literals++
+
+	data := []*Node{}
+	for i := 0; i < len(str); i++ {
+		data = append(data, NewNodeNumType(int(int8(str[i])), charType))
+	}
+	data = append(data, NewNodeNumType(0, charType))
+
+	np.statics = append(np.statics, NewNodeGVarDef(t, true, NewNodeBlock(data)))
+	return NewNodeGVar(t)
+}
+
+// vaStart parses the arguments of va_start after name.
+func (np *NodeParser) vaStart(name *token.Token) (*Node, error) {
+	if np.vaArea == nil {
+		return nil, name.NewTokenError(util.NotVariadicError, "va_start used in a function with fixed arguments")
+	}
+
+	args, err := np.Args()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 2 {
+		return nil, name.NewTokenError(util.InvalidOperandError, "va_start takes 2 arguments, but %d", len(args))
+	}
+
+	return NewNodeVaStart(args[0], np.params, np.vaArea), nil
+}
+
+// vaArg parses `(ap, type)` of va_arg.
+func (np *NodeParser) vaArg() (*Node, error) {
+	if err := np.token.ConsumeReserved("("); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ap, err := np.Assign()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := np.token.ConsumeReserved(","); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	t, err := np.TypeName()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := np.token.ConsumeReserved(")"); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return NewNodeVaArg(ap, t), nil
+}
+
+// Args parses the arguments of a function call.
+func (np *NodeParser) Args() ([]*Node, error) {
+	err := np.token.ConsumeReserved("(")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	args := []*Node{}
+	first := true
+	for !np.token.Expect(")") {
+		if first {
+			first = false
+		} else {
+			if err := np.token.ConsumeReserved(","); err != nil {
 				return nil, errors.WithStack(err)
 			}
-
-			args = append(args, argsNode)
 		}
 
-		err = np.token.ConsumeReserved(")")
+		argsNode, err := np.Assign()
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		return NewNodeCallFunc(name, args), nil
+		args = append(args, argsNode)
+	}
+
+	err = np.token.ConsumeReserved(")")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return args, nil
+}
+
+// member returns the member name of the struct or union n.
+func member(op token.Token, n *Node, name string) (*Node, error) {
+	if n.Variable.Type != vars.StructType {
+		return nil, op.NewTokenError(util.InvalidOperandError, "request for member %s in something not a struct: %s", name, n.Variable.Type)
+	}
+	if !n.Variable.Struct.Complete {
+		return nil, op.NewTokenError(util.InvalidTypeError, "member %s of an incomplete type", name)
+	}
+	m, ok := n.Variable.Struct.Member(name)
+	if !ok {
+		return nil, op.NewTokenError(util.NotVariableError, "no member named %s", name)
+	}
+
+	// the member of a const struct is const
+	t := m
+	t.Name, t.Offset = "", 0
+	t.Const = t.Const || n.Variable.Const
+	t.Volatile = t.Volatile || n.Variable.Volatile
+
+	// s.m is *(&s + offset of m) as a pointer to m. A struct which is not a
+	// variable, like `c ? s : t`, is evaluated to its address.
+	base := n
+	if n.IsLvalue() {
+		base = NewNode(ND_ADDR, n, nil)
 	}
+	addr := &Node{
+		Kind:     ND_ADD,
+		Left:     base,
+		Right:    NewNodeNumType(m.Offset, longType),
+		Variable: vars.PointerTo(t),
+	}
+	return NewNode(ND_DEREF, nil, addr), nil
+}
 
-	if variable, ok := locals.Get(name); !ok {
-		return nil, util.CompileError{
-			Input:   np.token.GetInput(),
-			Message: fmt.Sprintf("%s is not defined.", name),
-			Pos:     np.token.GetPos(),
+// checkCall reports an error on a call passing or returning a struct by value,
+// which is not supported.
+func checkCall(op token.Token, call *Node) error {
+	if call.Variable.Type == vars.StructType {
+		return op.NewTokenError(util.InvalidTypeError, "returning a struct by value is not supported")
+	}
+	for _, arg := range call.Args {
+		if arg.Variable.Type == vars.StructType {
+			return op.NewTokenError(util.InvalidTypeError, "passing a struct by value is not supported")
 		}
-	} else {
-		if variable.Type == vars.ArrayType && np.token.Expect("[") {
-			if err := np.token.ConsumeReserved("["); err != nil {
-				return nil, errors.WithStack(err)
-			}
+	}
 
-			n, err := np.token.ConsumeNumber()
-			if err != nil {
-				return nil, errors.WithStack(err)
+	return nil
+}
+
+// scalePointer multiplies right by the size of the element pointed by left
+// when left is a pointer.
+func scalePointer(left *Node, right *Node) *Node {
+	if !left.Variable.IsPointerLike() {
+		return right
+	}
+
+	size := left.Variable.Pointer.Size()
+	if right.IsNum() {
+		return NewNodeNumType(right.Val*size, longType)
+	}
+	return NewNode(ND_MUL, right, NewNodeNumType(size, longType))
+}
+
+func newAdd(left *Node, right *Node) *Node {
+	// n + p is p + n
+	if right.Variable.IsPointerLike() && !left.Variable.IsPointerLike() {
+		left, right = right, left
+	}
+
+	return NewNode(ND_ADD, left, scalePointer(left, right))
+}
+
+func newSub(left *Node, right *Node) *Node {
+	// p - q is the number of elements between them
+	if left.Variable.IsPointerLike() && right.Variable.IsPointerLike() {
+		node := NewNode(ND_SUB, left, right)
+		return NewNode(ND_DIV, node, NewNodeNumType(left.Variable.Pointer.Size(), longType))
+	}
+
+	return NewNode(ND_SUB, left, scalePointer(left, right))
+}
+
+// typeOf returns the type of the expression n.
+func typeOf(n *Node) vars.Variable {
+	switch n.Kind {
+	case ND_ADD, ND_SUB:
+		if n.Left.Variable.IsPointerLike() && n.Right.Variable.IsPointerLike() {
+			return longType
+		}
+		if n.Left.Variable.IsPointerLike() {
+			return vars.PointerTo(*n.Left.Variable.Pointer)
+		}
+		return integerType(n.Left.Variable)
+	case ND_MUL, ND_DIV, ND_MOD,
+		ND_BIT_AND, ND_BIT_OR, ND_BIT_XOR, ND_SHL, ND_SHR:
+		return integerType(n.Left.Variable)
+	case ND_EQ, ND_NE, ND_LT, ND_LE:
+		return intType
+	case ND_BIT_NOT:
+		return integerType(n.Right.Variable)
+	case ND_ASSIGN:
+		return n.Left.Variable
+	case ND_DEREF:
+		if n.Right.Variable.IsPointerLike() {
+			return *n.Right.Variable.Pointer
+		}
+		// *f is f itself for a function f
+		if n.Right.Variable.Type == vars.FuncType {
+			return n.Right.Variable
+		}
+		return intType
+	case ND_ADDR:
+		return vars.PointerTo(n.Left.Variable)
+	case ND_COMMA:
+		return n.Right.Variable
+	case ND_COND:
+		return unifyType(n.Right.Left.Variable, n.Right.Right.Variable)
+	}
+
+	return vars.Variable{}
+}
+
+// integerType returns the integer type of v without its name.
+func integerType(v vars.Variable) vars.Variable {
+	return vars.Variable{
+		Type:     v.Type,
+		Unsigned: v.Unsigned,
+	}
+}
+
+// promote applies the integer promotions to n.
+func promote(n *Node) *Node {
+	if n.Variable.IsInteger() && n.Variable.Size() < intType.Size() {
+		return NewNodeCast(intType, n)
+	}
+
+	return n
+}
+
+// usualArithConv converts arithmetic operands left and right to their common type.
+func usualArithConv(left *Node, right *Node) (*Node, *Node) {
+	if !left.Variable.IsArithmetic() || !right.Variable.IsArithmetic() {
+		return left, right
+	}
+
+	if left.Variable.IsFloat() || right.Variable.IsFloat() {
+		t := floatType
+		if left.Variable.Type == vars.DoubleType || right.Variable.Type == vars.DoubleType {
+			t = doubleType
+		}
+		return convert(left, t), convert(right, t)
+	}
+
+	left, right = promote(left), promote(right)
+
+	var t vars.Variable
+	switch {
+	case left.Variable.Size() > right.Variable.Size():
+		t = integerType(left.Variable)
+	case left.Variable.Size() < right.Variable.Size():
+		t = integerType(right.Variable)
+	default:
+		t = integerType(left.Variable)
+		t.Unsigned = left.Variable.Unsigned || right.Variable.Unsigned
+	}
+
+	return convert(left, t), convert(right, t)
+}
+
+// convert casts n to t unless it already has the type.
+func convert(n *Node, t vars.Variable) *Node {
+	if n.Variable.IsPointerLike() && t.IsPointerLike() {
+		return n
+	}
+	if n.Variable.Type == t.Type && n.Variable.Unsigned == t.Unsigned {
+		return n
+	}
+
+	return NewNodeCast(t, n)
+}
+
+// evalConst evaluates the constant expression n. The value is the float for a
+// floating type and the int otherwise.
+func evalConst(n *Node) (int, float64, bool) {
+	switch n.Kind {
+	case ND_NUM:
+		return n.Val, n.FVal, true
+	case ND_CAST:
+		i, f, ok := evalConst(n.Right)
+		if !ok {
+			return 0, 0, false
+		}
+
+		from, to := n.Right.Variable, n.Variable
+		switch {
+		case from.IsFloat() && to.IsFloat():
+			return 0, roundFloat(f, to), true
+		case from.IsFloat() && to.Type == vars.BoolType:
+			if f != 0 {
+				return 1, 0, true
 			}
+			return 0, 0, true
+		case from.IsFloat() && to.Unsigned && to.Size() == 8:
+			return int(uint64(f)), 0, true
+		case from.IsFloat():
+			return truncateConst(int(f), to), 0, true
+		case to.IsFloat() && from.Unsigned && from.Size() == 8:
+			return 0, roundFloat(float64(uint64(i)), to), true
+		case to.IsFloat():
+			return 0, roundFloat(float64(i), to), true
+		}
+		return truncateConst(i, to), 0, true
+	case ND_COND:
+		c, _, ok := evalConst(n.Left)
+		if !ok {
+			return 0, 0, false
+		}
+		if c != 0 {
+			return evalConst(n.Right.Left)
+		}
+		return evalConst(n.Right.Right)
+	case ND_BIT_NOT:
+		i, _, ok := evalConst(n.Right)
+		return truncateConst(^i, n.Variable), 0, ok
+	case ND_ADD, ND_SUB, ND_MUL, ND_DIV, ND_MOD,
+		ND_BIT_AND, ND_BIT_OR, ND_BIT_XOR, ND_SHL, ND_SHR,
+		ND_EQ, ND_NE, ND_LT, ND_LE:
+		// an address isn't known until link time
+		if n.Left.Variable.IsPointerLike() || n.Right.Variable.IsPointerLike() {
+			return 0, 0, false
+		}
 
-			if err := np.token.ConsumeReserved("]"); err != nil {
-				return nil, errors.WithStack(err)
+		li, lf, ok := evalConst(n.Left)
+		if !ok {
+			return 0, 0, false
+		}
+		ri, rf, ok := evalConst(n.Right)
+		if !ok {
+			return 0, 0, false
+		}
+
+		if n.Left.Variable.IsFloat() {
+			return evalFloatBinary(n.Kind, lf, rf, n.Variable)
+		}
+		return evalIntBinary(n.Kind, li, ri, n.Left.Variable.Unsigned, n.Variable)
+	}
+
+	return 0, 0, false
+}
+
+func evalIntBinary(kind NodeKind, l int, r int, unsigned bool, t vars.Variable) (int, float64, bool) {
+	v := 0
+	switch kind {
+	case ND_ADD:
+		v = l + r
+	case ND_SUB:
+		v = l - r
+	case ND_MUL:
+		v = l * r
+	case ND_DIV, ND_MOD:
+		if r == 0 {
+			return 0, 0, false
+		}
+		switch {
+		case unsigned && kind == ND_DIV:
+			v = int(uint64(l) / uint64(r))
+		case unsigned:
+			v = int(uint64(l) % uint64(r))
+		case kind == ND_DIV:
+			v = l / r
+		default:
+			v = l % r
+		}
+	case ND_BIT_AND:
+		v = l & r
+	case ND_BIT_OR:
+		v = l | r
+	case ND_BIT_XOR:
+		v = l ^ r
+	case ND_SHL:
+		v = l << uint(r)
+	case ND_SHR:
+		if unsigned {
+			v = int(uint64(l) >> uint(r))
+		} else {
+			v = l >> uint(r)
+		}
+	case ND_EQ:
+		v = boolInt(l == r)
+	case ND_NE:
+		v = boolInt(l != r)
+	case ND_LT:
+		if unsigned {
+			v = boolInt(uint64(l) < uint64(r))
+		} else {
+			v = boolInt(l < r)
+		}
+	case ND_LE:
+		if unsigned {
+			v = boolInt(uint64(l) <= uint64(r))
+		} else {
+			v = boolInt(l <= r)
+		}
+	}
+
+	return truncateConst(v, t), 0, true
+}
+
+func evalFloatBinary(kind NodeKind, l float64, r float64, t vars.Variable) (int, float64, bool) {
+	switch kind {
+	case ND_ADD:
+		return 0, roundFloat(l+r, t), true
+	case ND_SUB:
+		return 0, roundFloat(l-r, t), true
+	case ND_MUL:
+		return 0, roundFloat(l*r, t), true
+	case ND_DIV:
+		return 0, roundFloat(l/r, t), true
+	case ND_EQ:
+		return boolInt(l == r), 0, true
+	case ND_NE:
+		return boolInt(l != r), 0, true
+	case ND_LT:
+		return boolInt(l < r), 0, true
+	case ND_LE:
+		return boolInt(l <= r), 0, true
+	}
+
+	return 0, 0, false
+}
+
+// truncateConst converts v to the integer type t the same as the generated code.
+func truncateConst(v int, t vars.Variable) int {
+	switch {
+	case t.Type == vars.BoolType:
+		return boolInt(v != 0)
+	case t.Size() == 2 && t.Unsigned:
+		return int(uint16(v))
+	case t.Size() == 2:
+		return int(int16(v))
+	case t.Size() == 4 && t.Unsigned:
+		return int(uint32(v))
+	case t.Size() == 4:
+		return int(int32(v))
+	}
+
+	return v
+}
+
+// roundFloat rounds f to the precision of the floating type t.
+func roundFloat(f float64, t vars.Variable) float64 {
+	if t.Type == vars.FloatType {
+		return float64(float32(f))
+	}
+
+	return f
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// condition converts a floating controlling expression to _Bool,
+// since its bit pattern can't be compared with 0 directly.
+func condition(n *Node) *Node {
+	if n.Variable.IsFloat() {
+		return NewNodeCast(boolType, n)
+	}
+
+	return n
+}
+
+// defaultPromote applies the default argument promotions to an argument of a
+// function without a known parameter type.
+func defaultPromote(n *Node) *Node {
+	if n.Variable.Type == vars.FloatType {
+		return NewNodeCast(doubleType, n)
+	}
+
+	return promote(n)
+}
+
+// checkConst returns an error at op when n, the lvalue modified by op, is const.
+func checkConst(op token.Token, name string, n *Node) error {
+	if n.Variable.Const {
+		return op.NewTokenError(util.ConstAssignError, "cannot modify a const object with %s", name)
+	}
+
+	return nil
+}
+
+// divByZero reports whether left / right is an integer division by a constant
+// expression evaluated to 0. A floating division by zero is valid.
+func divByZero(left *Node, right *Node) bool {
+	if !left.Variable.IsInteger() || !right.Variable.IsInteger() {
+		return false
+	}
+
+	v, _, ok := evalConst(right)
+	return ok && v == 0
+}
+
+// checkInteger returns an error at op when any operand is not an integer.
+func checkInteger(op token.Token, name string, nodes ...*Node) error {
+	for _, n := range nodes {
+		if n.Variable.IsFloat() {
+			return op.NewTokenError(util.InvalidOperandError, "invalid operand of %s: %s", name, n.Variable.Type)
+		}
+	}
+
+	return nil
+}
+
+// numberType returns the type of an integer literal selected by the tokenizer.
+func numberType(unsigned bool, long bool) vars.Variable {
+	t := intType
+	if long {
+		t = longType
+	}
+	t.Unsigned = unsigned
+
+	return t
+}
+
+// unifyType returns the type of `cond ? then : els` checked by checkCond.
+// Arrays and functions decay to pointers and a pointer operand wins over an integer one.
+func unifyType(then vars.Variable, els vars.Variable) vars.Variable {
+	for _, v := range []vars.Variable{then, els} {
+		switch v.Type {
+		case vars.PointerType:
+			return vars.Variable{
+				Type:    v.Type,
+				Pointer: v.Pointer,
 			}
+		case vars.ArrayType:
+			return vars.PointerTo(*v.Pointer)
+		case vars.FuncType:
+			return vars.PointerTo(v)
+		}
+	}
 
-			return &Node{
-				Kind:       ND_LVAR,
-				Variable:   variable,
-				ArrayIndex: n,
-			}, nil
+	switch then.Type {
+	case vars.StructType:
+		return vars.Variable{
+			Type:   then.Type,
+			Struct: then.Struct,
 		}
+	case vars.VoidType:
+		return then
+	}
+
+	return integerType(then)
+}
 
-		return NewNodeLVar(variable), nil
+// checkCond returns an error at op when then and els of `cond ? then : els`
+// have no common type.
+func checkCond(op token.Token, then *Node, els *Node) error {
+	t, e := then.Variable, els.Variable
+	pointer := func(v vars.Variable) bool {
+		return v.IsPointerLike() || v.Type == vars.FuncType
 	}
+
+	switch {
+	case t.IsArithmetic() && e.IsArithmetic():
+	case pointer(t) && (pointer(e) || e.IsInteger()):
+	case pointer(e) && t.IsInteger():
+	case t.Type == vars.VoidType && e.Type == vars.VoidType:
+	case t.Type == vars.StructType && e.Type == vars.StructType && t.Struct == e.Struct:
+	default:
+		return op.NewTokenError(util.InvalidOperandError, "operands of ?: have no common type")
+	}
+
+	return nil
 }
 
+var (
+	boolType   = vars.NewVariable("", vars.BoolType)
+	charType   = vars.NewVariable("", vars.CharType)
+	intType    = vars.NewVariable("", vars.IntType)
+	longType   = vars.NewVariable("", vars.LongType)
+	ulongType  = vars.Variable{Type: vars.LongType, Unsigned: true}
+	floatType  = vars.NewVariable("", vars.FloatType)
+	doubleType = vars.NewVariable("", vars.DoubleType)
+
+	// va_list is an array of one struct { gp_offset, fp_offset uint32; overflow_arg_area,
+	// reg_save_area *void } in the SysV ABI, which is the same size as long[3]
+	vaListType = vars.ArrayOf(longType, 3)
+)
+
+// vaAreaSize is the size of the register save area of a variadic function,
+// which holds 6 general purpose registers and 8 xmm registers.
+const vaAreaSize = 6*8 + 8*16
+
+// functions holds the type of the defined functions.
+var functions = map[string]vars.Variable{}
+
+// globals holds the global variables.
+var globals = map[string]vars.Variable{}
+
 var locals = vars.NewLocalVariales()
+
+// typedefs holds the types named by typedef. va_list is built in so that it
+// can be used without <stdarg.h>.
+var typedefs = map[string]vars.Variable{"va_list": vaListType}
+
+// tags holds the structs and unions by their tags.
+var tags = map[string]*vars.Struct{}
+
+// enums holds the values of the enum constants.
+var enums = map[string]int{}
+
+// literals is the number of the string literals, which names the next one.
+var literals = 0
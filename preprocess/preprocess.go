@@ -0,0 +1,1422 @@
+package preprocess
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ryota-sakamoto/c8go/util"
+)
+
+type ppKind int
+
+const (
+	ppIdent ppKind = iota + 1
+	ppNumber
+	ppString
+	ppChar
+	ppPunct
+	ppOther
+
+	// ppPlacemarker stands for an empty argument of ## and is removed after the substitution
+	ppPlacemarker
+)
+
+// source is a file being preprocessed.
+type source struct {
+	// name is reported by __FILE__ and the line markers, and may be changed by #line
+	name  string
+	path  string
+	input string
+
+	// delta is added to the physical line by #line
+	delta int
+
+	// dir is the index of the include path the file was found in, or -1
+	dir int
+
+	// lines is input split into lines, made when a line is first needed
+	lines []string
+}
+
+// line returns the line n from 0 of s.
+func (s *source) line(n int) string {
+	if s.lines == nil {
+		s.lines = strings.Split(s.input, "\n")
+	}
+	if n < len(s.lines) {
+		return s.lines[n]
+	}
+
+	return ""
+}
+
+type ppToken struct {
+	kind ppKind
+	text string
+
+	src  *source
+	line int
+	col  int
+
+	// bol is set on the first token of a line, space on a token preceded by white space
+	bol   bool
+	space bool
+
+	// expanded is set on a token produced by a macro expansion, which has the
+	// position of the macro invocation
+	expanded bool
+	hide     map[string]bool
+}
+
+// lineNo returns the line number of t reported by __LINE__, starting at 1.
+func (t *ppToken) lineNo() int {
+	return t.line + 1 + t.src.delta
+}
+
+func (t *ppToken) is(s string) bool {
+	return t.kind == ppPunct && t.text == s
+}
+
+type macro struct {
+	name     string
+	funcLike bool
+	params   []string
+	variadic bool
+	body     []*ppToken
+
+	// builtin computes the expansion of __FILE__ and __LINE__
+	builtin func(t *ppToken) *ppToken
+}
+
+// cond is an #if group.
+type cond struct {
+	tok *ppToken
+
+	// active is set while the current branch is included, and taken once any branch was
+	active  bool
+	taken   bool
+	sawElse bool
+
+	// parent reports whether the enclosing group is included
+	parent bool
+}
+
+// maxIncludeDepth limits the nesting of #include, which stops a recursive include.
+const maxIncludeDepth = 200
+
+type Preprocessor struct {
+	includePaths []string
+	macros       map[string]*macro
+	once         map[string]bool
+	depth        int
+	out          writer
+}
+
+// NewPreprocessor returns a preprocessor searching includePaths for headers
+// before the system include paths.
+func NewPreprocessor(includePaths []string) *Preprocessor {
+	p := &Preprocessor{
+		includePaths: append(append([]string{}, includePaths...), systemIncludePaths()...),
+		macros:       map[string]*macro{},
+		once:         map[string]bool{},
+	}
+
+	for _, v := range []string{
+		"__STDC__ 1",
+		"__STDC_VERSION__ 201112L",
+		"__STDC_HOSTED__ 1",
+		"__x86_64__ 1",
+		"__x86_64 1",
+		"__linux__ 1",
+		"__linux 1",
+		"__unix__ 1",
+		"__unix 1",
+		"__LP64__ 1",
+		"_LP64 1",
+		"__CHAR_BIT__ 8",
+		"__SIZEOF_SHORT__ 2",
+		"__SIZEOF_INT__ 4",
+		"__SIZEOF_LONG__ 8",
+		"__SIZEOF_LONG_LONG__ 8",
+		"__SIZEOF_POINTER__ 8",
+		"__SIZEOF_FLOAT__ 4",
+		"__SIZEOF_DOUBLE__ 8",
+		"__SCHAR_MAX__ 0x7f",
+		"__SHRT_MAX__ 0x7fff",
+		"__INT_MAX__ 0x7fffffff",
+		"__LONG_MAX__ 0x7fffffffffffffffL",
+		"__LONG_LONG_MAX__ 0x7fffffffffffffffLL",
+		"__WCHAR_MAX__ 0x7fffffff",
+		"__SIZE_MAX__ 0xffffffffffffffffUL",
+		"__PTRDIFF_MAX__ 0x7fffffffffffffffL",
+		"__INTMAX_MAX__ 0x7fffffffffffffffL",
+		"__UINTMAX_MAX__ 0xffffffffffffffffUL",
+	} {
+		src := &source{name: "<built-in>", input: v, dir: -1}
+		tokens, _ := lex(src)
+		p.define(tokens)
+	}
+
+	p.macros["__FILE__"] = &macro{name: "__FILE__", builtin: func(t *ppToken) *ppToken {
+		c := *t
+		c.kind = ppString
+		c.text = quote(t.src.name)
+		return &c
+	}}
+	p.macros["__LINE__"] = &macro{name: "__LINE__", builtin: func(t *ppToken) *ppToken {
+		c := *t
+		c.kind = ppNumber
+		c.text = strconv.Itoa(t.lineNo())
+		return &c
+	}}
+
+	return p
+}
+
+// systemIncludePaths returns the directories searched for headers after the -I paths,
+// in the order of gcc.
+func systemIncludePaths() []string {
+	paths, _ := filepath.Glob("/usr/lib/gcc/x86_64-linux-gnu/*/include")
+	return append(paths,
+		"/usr/local/include",
+		"/usr/include/x86_64-linux-gnu",
+		"/usr/include",
+	)
+}
+
+// Run preprocesses src read from file, and returns the text to tokenize, which is
+// also the output of -E. The text starts with the line marker `# 1 "file"`, and
+// another line marker is put where its lines do not follow the lines of src.
+func (p *Preprocessor) Run(src string, file string) (string, error) {
+	fmt.Fprintf(&p.out.b, "# 1 %s\n", quote(file))
+	p.out.file = file
+	p.out.line = 1
+	if err := p.file(&source{name: file, path: file, input: src, dir: -1}); err != nil {
+		return "", err
+	}
+
+	return p.out.String(), nil
+}
+
+func (p *Preprocessor) file(src *source) error {
+	tokens, err := lex(src)
+	if err != nil {
+		return err
+	}
+
+	s := &stream{toks: tokens}
+	conds := []*cond{}
+	for t := s.next(); t != nil; t = s.next() {
+		if t.bol && t.is("#") {
+			if err := p.directive(t, s, &conds); err != nil {
+				return err
+			}
+			continue
+		}
+		if skipping(conds) {
+			continue
+		}
+
+		ok, err := p.expand(t, s)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			p.out.token(t)
+		}
+	}
+
+	if len(conds) > 0 {
+		return errorAt(conds[len(conds)-1].tok, "unterminated #%s", conds[len(conds)-1].tok.text)
+	}
+
+	return nil
+}
+
+func skipping(conds []*cond) bool {
+	return len(conds) > 0 && !conds[len(conds)-1].active
+}
+
+// readLine reads the rest of the directive line.
+func readLine(s *stream) []*ppToken {
+	line := []*ppToken{}
+	for t := s.peek(); t != nil && !t.bol; t = s.peek() {
+		line = append(line, s.next())
+	}
+
+	return line
+}
+
+func (p *Preprocessor) directive(hash *ppToken, s *stream, conds *[]*cond) error {
+	line := readLine(s)
+	if len(line) == 0 {
+		// the null directive
+		return nil
+	}
+	name, args := line[0], line[1:]
+	active := !skipping(*conds)
+
+	switch name.text {
+	case "if", "ifdef", "ifndef":
+		c := &cond{tok: name, parent: active}
+		if active {
+			v, err := p.condition(name, args)
+			if err != nil {
+				return err
+			}
+			c.active, c.taken = v, v
+		}
+		*conds = append(*conds, c)
+		return nil
+	case "elif", "else", "endif":
+		if len(*conds) == 0 {
+			return errorAt(name, "#%s without #if", name.text)
+		}
+		c := (*conds)[len(*conds)-1]
+		if c.sawElse && name.text != "endif" {
+			return errorAt(name, "#%s after #else", name.text)
+		}
+
+		switch name.text {
+		case "elif":
+			c.active = false
+			if c.parent && !c.taken {
+				v, err := p.condition(name, args)
+				if err != nil {
+					return err
+				}
+				c.active, c.taken = v, v
+			}
+		case "else":
+			c.active = c.parent && !c.taken
+			c.taken = true
+			c.sawElse = true
+		case "endif":
+			*conds = (*conds)[:len(*conds)-1]
+		}
+		return nil
+	}
+
+	if !active {
+		return nil
+	}
+
+	switch name.text {
+	case "include", "include_next":
+		return p.include(name, args, name.text == "include_next")
+	case "define":
+		return p.define(args)
+	case "undef":
+		if len(args) == 0 || args[0].kind != ppIdent {
+			return errorAt(name, "macro names must be identifiers")
+		}
+		delete(p.macros, args[0].text)
+		return nil
+	case "line":
+		return p.line(name, args)
+	case "error":
+		return errorAt(hash, "#error %s", join(args))
+	case "warning":
+		fmt.Fprintf(os.Stderr, "%s:%d: warning: #warning %s\n", hash.src.name, hash.lineNo(), join(args))
+		return nil
+	case "pragma":
+		if len(args) > 0 && args[0].text == "once" {
+			p.once[hash.src.path] = true
+		}
+		return nil
+	case "ident", "sccs":
+		return nil
+	}
+
+	return errorAt(name, "invalid preprocessing directive #%s", name.text)
+}
+
+func (p *Preprocessor) include(name *ppToken, args []*ppToken, next bool) error {
+	if len(args) > 0 && args[0].kind != ppString && !args[0].is("<") {
+		expanded, err := p.expandAll(args)
+		if err != nil {
+			return err
+		}
+		args = expanded
+	}
+	if len(args) == 0 {
+		return errorAt(name, "#%s expects \"FILENAME\" or <FILENAME>", name.text)
+	}
+
+	file := ""
+	quoted := false
+	switch {
+	case args[0].kind == ppString:
+		file = args[0].text[1 : len(args[0].text)-1]
+		quoted = true
+	case args[0].is("<"):
+		var b strings.Builder
+		closed := false
+		for _, t := range args[1:] {
+			if t.is(">") {
+				closed = true
+				break
+			}
+			if t.space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(t.text)
+		}
+		if !closed {
+			return errorAt(args[0], "missing terminating > character")
+		}
+		file = b.String()
+	default:
+		return errorAt(name, "#%s expects \"FILENAME\" or <FILENAME>", name.text)
+	}
+	if file == "" {
+		return errorAt(args[0], "empty filename in #%s", name.text)
+	}
+
+	path, dir, ok := p.find(file, quoted, name.src, next)
+	if !ok {
+		return errorAt(args[0], "%s: No such file or directory", file)
+	}
+	if p.once[path] {
+		return nil
+	}
+	if p.depth >= maxIncludeDepth {
+		return errorAt(name, "#include nested depth %d exceeds maximum", maxIncludeDepth)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errorAt(args[0], "%s", err)
+	}
+
+	p.depth++
+	defer func() { p.depth-- }()
+	return p.file(&source{name: path, path: path, input: string(data), dir: dir})
+}
+
+// find searches for the header file. A quoted header is searched in the directory
+// of the current file first, and #include_next starts after the include path the
+// current file was found in.
+func (p *Preprocessor) find(file string, quoted bool, src *source, next bool) (string, int, bool) {
+	if filepath.IsAbs(file) {
+		return file, -1, exists(file)
+	}
+
+	start := 0
+	if next {
+		start = src.dir + 1
+	} else if quoted {
+		path := filepath.Join(filepath.Dir(src.path), file)
+		if exists(path) {
+			return path, -1, true
+		}
+	}
+
+	for i := start; i < len(p.includePaths); i++ {
+		path := filepath.Join(p.includePaths[i], file)
+		if exists(path) {
+			return path, i, true
+		}
+	}
+
+	return "", 0, false
+}
+
+func exists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// define defines the macro of the #define line `name body` or `name(params) body`.
+func (p *Preprocessor) define(args []*ppToken) error {
+	if len(args) == 0 || args[0].kind != ppIdent {
+		if len(args) == 0 {
+			return nil
+		}
+		return errorAt(args[0], "macro names must be identifiers")
+	}
+
+	m := &macro{name: args[0].text}
+	body := args[1:]
+
+	// a function-like macro has no space between the name and (
+	if len(body) > 0 && body[0].is("(") && !body[0].space {
+		m.funcLike = true
+		i := 1
+		if i < len(body) && body[i].is(")") {
+			i++
+		} else {
+			for {
+				if i >= len(body) {
+					return errorAt(args[0], "missing ')' in macro parameter list")
+				}
+				t := body[i]
+				i++
+				switch {
+				case t.is("..."):
+					m.variadic = true
+				case t.kind == ppIdent:
+					m.params = append(m.params, t.text)
+				default:
+					return errorAt(t, "expected parameter name, found %q", t.text)
+				}
+
+				if i >= len(body) {
+					return errorAt(args[0], "missing ')' in macro parameter list")
+				}
+				sep := body[i]
+				i++
+				if sep.is(")") {
+					break
+				}
+				if !sep.is(",") || m.variadic {
+					return errorAt(sep, "expected ',' or ')', found %q", sep.text)
+				}
+			}
+		}
+		body = body[i:]
+	}
+
+	for i, t := range body {
+		c := *t
+		if i == 0 {
+			c.space = false
+		}
+		m.body = append(m.body, &c)
+	}
+
+	if n := len(m.body); n > 0 && (m.body[0].is("##") || m.body[n-1].is("##")) {
+		return errorAt(args[0], "'##' cannot appear at either end of a macro expansion")
+	}
+	if m.funcLike {
+		for i, t := range m.body {
+			if t.is("#") && (i+1 >= len(m.body) || m.param(m.body[i+1]) < 0) {
+				return errorAt(t, "'#' is not followed by a macro parameter")
+			}
+		}
+	}
+
+	p.macros[m.name] = m
+	return nil
+}
+
+// param returns the index of the parameter named by t, or -1.
+// __VA_ARGS__ is the parameter after the named ones.
+func (m *macro) param(t *ppToken) int {
+	if t.kind != ppIdent {
+		return -1
+	}
+	for i, name := range m.params {
+		if name == t.text {
+			return i
+		}
+	}
+	if m.variadic && t.text == "__VA_ARGS__" {
+		return len(m.params)
+	}
+
+	return -1
+}
+
+func (p *Preprocessor) line(name *ppToken, args []*ppToken) error {
+	args, err := p.expandAll(args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 || args[0].kind != ppNumber {
+		return errorAt(name, "#line directive requires a positive integer argument")
+	}
+	n, err := strconv.Atoi(args[0].text)
+	if err != nil || n <= 0 {
+		return errorAt(args[0], "%q after #line is not a positive integer", args[0].text)
+	}
+	if len(args) > 1 {
+		if args[1].kind != ppString {
+			return errorAt(args[1], "invalid filename %q", args[1].text)
+		}
+		name.src.name = args[1].text[1 : len(args[1].text)-1]
+	}
+
+	// the line after the directive is the line n
+	name.src.delta = n - name.line - 2
+	return nil
+}
+
+// condition evaluates the condition of #if, #ifdef, #ifndef or #elif.
+func (p *Preprocessor) condition(name *ppToken, args []*ppToken) (bool, error) {
+	if name.text == "ifdef" || name.text == "ifndef" {
+		if len(args) == 0 || args[0].kind != ppIdent {
+			return false, errorAt(name, "no macro name given in #%s directive", name.text)
+		}
+		_, ok := p.macros[args[0].text]
+		return ok == (name.text == "ifdef"), nil
+	}
+
+	// defined is replaced before the macros are expanded
+	tokens := []*ppToken{}
+	for i := 0; i < len(args); i++ {
+		t := args[i]
+		if t.kind != ppIdent || t.text != "defined" {
+			tokens = append(tokens, t)
+			continue
+		}
+
+		j := i + 1
+		paren := j < len(args) && args[j].is("(")
+		if paren {
+			j++
+		}
+		if j >= len(args) || args[j].kind != ppIdent {
+			return false, errorAt(t, "operator \"defined\" requires an identifier")
+		}
+		if paren && (j+1 >= len(args) || !args[j+1].is(")")) {
+			return false, errorAt(t, "missing ')' after \"defined\"")
+		}
+
+		c := *t
+		c.kind = ppNumber
+		c.text = "0"
+		if _, ok := p.macros[args[j].text]; ok {
+			c.text = "1"
+		}
+		tokens = append(tokens, &c)
+
+		i = j
+		if paren {
+			i++
+		}
+	}
+
+	tokens, err := p.expandAll(tokens)
+	if err != nil {
+		return false, err
+	}
+	if len(tokens) == 0 {
+		return false, errorAt(name, "#%s with no expression", name.text)
+	}
+
+	e := &evaluator{tokens: tokens, directive: name}
+	v, err := e.conditional()
+	if err != nil {
+		return false, err
+	}
+	if e.pos < len(tokens) {
+		return false, errorAt(tokens[e.pos], "missing binary operator before token %q", tokens[e.pos].text)
+	}
+
+	return v.v != 0, nil
+}
+
+// expand expands t when it is a macro invocation, and pushes the expansion back
+// to s to be rescanned.
+func (p *Preprocessor) expand(t *ppToken, s *stream) (bool, error) {
+	if t.kind != ppIdent || t.hide[t.text] {
+		return false, nil
+	}
+	m, ok := p.macros[t.text]
+	if !ok {
+		return false, nil
+	}
+
+	if m.builtin != nil {
+		s.unread([]*ppToken{m.builtin(t)})
+		return true, nil
+	}
+
+	if !m.funcLike {
+		s.unread(expansion(t, m.body, hideset(t.hide, map[string]bool{m.name: true})))
+		return true, nil
+	}
+
+	// a function-like macro name without arguments is an identifier
+	if next := s.peek(); next == nil || !next.is("(") {
+		return false, nil
+	}
+	s.next()
+
+	args, rparen, err := readArgs(t, m, s)
+	if err != nil {
+		return false, err
+	}
+	body, err := p.subst(m, args)
+	if err != nil {
+		return false, err
+	}
+
+	s.unread(expansion(t, body, hideset(intersect(t.hide, rparen.hide), map[string]bool{m.name: true})))
+	return true, nil
+}
+
+// expandAll expands all the macros in tokens.
+func (p *Preprocessor) expandAll(tokens []*ppToken) ([]*ppToken, error) {
+	s := &stream{toks: tokens}
+	expanded := []*ppToken{}
+	for t := s.next(); t != nil; t = s.next() {
+		ok, err := p.expand(t, s)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			expanded = append(expanded, t)
+		}
+	}
+
+	return expanded, nil
+}
+
+// expansion places the tokens of the expansion of the macro invoked at t.
+func expansion(t *ppToken, body []*ppToken, hide map[string]bool) []*ppToken {
+	tokens := make([]*ppToken, len(body))
+	for i, b := range body {
+		c := *b
+		c.src, c.line, c.col = t.src, t.line, t.col
+		c.bol = false
+		c.expanded = true
+		c.hide = hideset(c.hide, hide)
+		if i == 0 {
+			c.space = t.space
+		}
+		tokens[i] = &c
+	}
+
+	return tokens
+}
+
+// readArgs reads the arguments of the invocation of m at t up to the closing parenthesis.
+func readArgs(t *ppToken, m *macro, s *stream) ([][]*ppToken, *ppToken, error) {
+	args := [][]*ppToken{{}}
+	depth := 0
+	var rparen *ppToken
+	for rparen == nil {
+		a := s.next()
+		if a == nil {
+			return nil, nil, errorAt(t, "unterminated argument list invoking macro %q", m.name)
+		}
+
+		switch {
+		case depth == 0 && a.is(")"):
+			rparen = a
+			continue
+		case depth == 0 && a.is(",") && (!m.variadic || len(args) <= len(m.params)):
+			args = append(args, []*ppToken{})
+			continue
+		case a.is("("):
+			depth++
+		case a.is(")"):
+			depth--
+		}
+		args[len(args)-1] = append(args[len(args)-1], a)
+	}
+
+	n := len(m.params)
+	switch {
+	case m.variadic && len(args) == n:
+		// the variable arguments are omitted
+		args = append(args, []*ppToken{})
+	case m.variadic && len(args) > n:
+	case n == 0 && len(args) == 1 && len(args[0]) == 0:
+		args = nil
+	case len(args) != n:
+		return nil, nil, errorAt(t, "macro %q passed %d arguments, but takes %d", m.name, len(args), n)
+	}
+	return args, rparen, nil
+}
+
+// subst replaces the parameters in the body of m with args. An argument is fully
+// macro expanded unless it is the operand of # or ##.
+func (p *Preprocessor) subst(m *macro, args [][]*ppToken) ([]*ppToken, error) {
+	tokens := []*ppToken{}
+	body := m.body
+	for i := 0; i < len(body); i++ {
+		t := body[i]
+
+		if t.is("#") && i+1 < len(body) && m.param(body[i+1]) >= 0 {
+			tokens = append(tokens, stringize(t, args[m.param(body[i+1])]))
+			i++
+			continue
+		}
+
+		if t.is("##") && i+1 < len(body) {
+			i++
+			rhs := []*ppToken{body[i]}
+			if idx := m.param(body[i]); idx >= 0 {
+				rhs = args[idx]
+
+				// GNU extension: `, ## __VA_ARGS__` drops the comma when the variable
+				// arguments are empty, and is the comma and the arguments otherwise
+				if body[i].text == "__VA_ARGS__" && tokens[len(tokens)-1].is(",") {
+					if len(rhs) == 0 {
+						tokens = tokens[:len(tokens)-1]
+					}
+					tokens = append(tokens, copyTokens(rhs)...)
+					continue
+				}
+			}
+			if len(rhs) == 0 {
+				continue
+			}
+
+			pasted, err := paste(tokens[len(tokens)-1], rhs[0])
+			if err != nil {
+				return nil, err
+			}
+			tokens[len(tokens)-1] = pasted
+			tokens = append(tokens, copyTokens(rhs[1:])...)
+			continue
+		}
+
+		if idx := m.param(t); idx >= 0 {
+			arg := copyTokens(args[idx])
+			if i+1 < len(body) && body[i+1].is("##") {
+				if len(arg) == 0 {
+					tokens = append(tokens, &ppToken{kind: ppPlacemarker, space: t.space})
+					continue
+				}
+			} else {
+				expanded, err := p.expandAll(arg)
+				if err != nil {
+					return nil, err
+				}
+				arg = expanded
+			}
+
+			if len(arg) > 0 {
+				c := *arg[0]
+				c.space = t.space
+				arg[0] = &c
+			}
+			tokens = append(tokens, arg...)
+			continue
+		}
+
+		c := *t
+		tokens = append(tokens, &c)
+	}
+
+	result := []*ppToken{}
+	for _, t := range tokens {
+		if t.kind != ppPlacemarker {
+			result = append(result, t)
+		}
+	}
+
+	return result, nil
+}
+
+// stringize returns the string literal of #arg.
+func stringize(hash *ppToken, arg []*ppToken) *ppToken {
+	var b strings.Builder
+	for i, t := range arg {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+
+	c := *hash
+	c.kind = ppString
+	c.text = quote(b.String())
+	return &c
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// paste concatenates l and r into a token for ##.
+func paste(l *ppToken, r *ppToken) (*ppToken, error) {
+	if l.kind == ppPlacemarker {
+		c := *r
+		c.space = l.space
+		return &c, nil
+	}
+
+	text := l.text + r.text
+	kind, n := scan(text)
+	if n != len(text) {
+		return nil, errorAt(l, "pasting %q and %q does not give a valid preprocessing token", l.text, r.text)
+	}
+
+	c := *l
+	c.kind = kind
+	c.text = text
+	return &c, nil
+}
+
+func copyTokens(tokens []*ppToken) []*ppToken {
+	copied := make([]*ppToken, len(tokens))
+	for i, t := range tokens {
+		c := *t
+		copied[i] = &c
+	}
+
+	return copied
+}
+
+// hideset returns the union of the hide sets, the macros which are not expanded
+// again in the expansion of themselves.
+func hideset(sets ...map[string]bool) map[string]bool {
+	h := map[string]bool{}
+	for _, set := range sets {
+		for name := range set {
+			h[name] = true
+		}
+	}
+
+	return h
+}
+
+func intersect(a map[string]bool, b map[string]bool) map[string]bool {
+	h := map[string]bool{}
+	for name := range a {
+		if b[name] {
+			h[name] = true
+		}
+	}
+
+	return h
+}
+
+func join(tokens []*ppToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && t.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+
+	return b.String()
+}
+
+func errorAt(t *ppToken, format string, a ...interface{}) error {
+	e := util.PreprocessError
+	e.File, e.LineNo = t.src.name, t.lineNo()
+	return e.New(t.src.input, fmt.Sprintf(format, a...), t.col+1, t.line)
+}
+
+// stream is the tokens to preprocess, with the tokens pushed back by an expansion
+// read first.
+type stream struct {
+	toks   []*ppToken
+	pushed []*ppToken
+}
+
+func (s *stream) next() *ppToken {
+	if n := len(s.pushed); n > 0 {
+		t := s.pushed[n-1]
+		s.pushed = s.pushed[:n-1]
+		return t
+	}
+	if len(s.toks) == 0 {
+		return nil
+	}
+
+	t := s.toks[0]
+	s.toks = s.toks[1:]
+	return t
+}
+
+func (s *stream) peek() *ppToken {
+	if n := len(s.pushed); n > 0 {
+		return s.pushed[n-1]
+	}
+	if len(s.toks) == 0 {
+		return nil
+	}
+
+	return s.toks[0]
+}
+
+func (s *stream) unread(tokens []*ppToken) {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		s.pushed = append(s.pushed, tokens[i])
+	}
+}
+
+var punctuators = []string{
+	"...", "<<=", ">>=",
+	"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"*=", "/=", "%=", "+=", "-=", "&=", "^=", "|=", "##",
+}
+
+// lex splits the input of src into preprocessing tokens. Comments are white space,
+// and a backslash at the end of a line joins the next line.
+func lex(src *source) ([]*ppToken, error) {
+	s := src.input
+	tokens := []*ppToken{}
+	line, col := 0, 0
+	bol, space := true, false
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == '\n':
+			i++
+			line++
+			col = 0
+			bol, space = true, false
+			continue
+		case strings.HasPrefix(s[i:], "\\\n") || strings.HasPrefix(s[i:], "\\\r\n"):
+			i += strings.IndexByte(s[i:], '\n') + 1
+			line++
+			col = 0
+			space = true
+			continue
+		case strings.IndexByte(" \t\r\f\v", s[i]) >= 0:
+			i++
+			col++
+			space = true
+			continue
+		case strings.HasPrefix(s[i:], "//"):
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s) - i
+			}
+			i += end
+			col += end
+			space = true
+			continue
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				e := util.PreprocessError
+				e.File, e.LineNo = src.name, line+1+src.delta
+				return nil, e.New(src.input, "unterminated comment", col+1, line)
+			}
+
+			comment := s[i : i+end+4]
+			if n := strings.Count(comment, "\n"); n > 0 {
+				line += n
+				col = len(comment) - strings.LastIndex(comment, "\n") - 1
+			} else {
+				col += len(comment)
+			}
+			i += len(comment)
+			space = true
+			continue
+		}
+
+		kind, n := scan(s[i:])
+		tokens = append(tokens, &ppToken{
+			kind:  kind,
+			text:  s[i : i+n],
+			src:   src,
+			line:  line,
+			col:   col,
+			bol:   bol,
+			space: space,
+		})
+		i += n
+		col += n
+		bol, space = false, false
+	}
+
+	return tokens, nil
+}
+
+// scan returns the kind and the length of the preprocessing token at the head of s.
+func scan(s string) (ppKind, int) {
+	c := s[0]
+
+	// the encoding prefixes of wide and UTF literals, such as L'a' and u8"a"
+	for _, prefix := range []string{"u8", "u", "U", "L"} {
+		if len(s) > len(prefix) && strings.HasPrefix(s, prefix) && (s[len(prefix)] == '"' || s[len(prefix)] == '\'') {
+			if kind, n := scan(s[len(prefix):]); kind != ppOther {
+				return kind, len(prefix) + n
+			}
+		}
+	}
+
+	switch {
+	case util.IsAlnum(c) && !('0' <= c && c <= '9'):
+		n := 1
+		for n < len(s) && util.IsAlnum(s[n]) {
+			n++
+		}
+		return ppIdent, n
+	case '0' <= c && c <= '9', c == '.' && len(s) > 1 && '0' <= s[1] && s[1] <= '9':
+		// a pp-number takes the sign of an exponent, such as 1e+5
+		n := 1
+		for n < len(s) {
+			if (s[n] == '+' || s[n] == '-') && strings.IndexByte("eEpP", s[n-1]) >= 0 {
+				n++
+				continue
+			}
+			if !util.IsAlnum(s[n]) && s[n] != '.' {
+				break
+			}
+			n++
+		}
+		return ppNumber, n
+	case c == '"', c == '\'':
+		n := 1
+		for n < len(s) && s[n] != c && s[n] != '\n' {
+			if s[n] == '\\' && n+1 < len(s) && s[n+1] != '\n' {
+				n++
+			}
+			n++
+		}
+		if n >= len(s) || s[n] != c {
+			// an unterminated literal is left to the tokenizer to report
+			return ppOther, 1
+		}
+		if c == '"' {
+			return ppString, n + 1
+		}
+		return ppChar, n + 1
+	}
+
+	for _, v := range punctuators {
+		if strings.HasPrefix(s, v) {
+			return ppPunct, len(v)
+		}
+	}
+	if strings.IndexByte("+-*/%&|^~!=<>?:;,.()[]{}#", c) >= 0 {
+		return ppPunct, 1
+	}
+
+	return ppOther, 1
+}
+
+// writer writes the preprocessed tokens. A token from the source is written at its
+// column, so that the errors of the tokenizer and the parser point to the source.
+type writer struct {
+	b    strings.Builder
+	file string
+	line int
+	col  int
+	last *ppToken
+}
+
+// maxBlankLines is the largest gap written as blank lines rather than a line marker.
+const maxBlankLines = 8
+
+func (w *writer) token(t *ppToken) {
+	file, line := t.src.name, t.lineNo()
+	if file != w.file || line < w.line || line-w.line > maxBlankLines {
+		if w.col > 0 {
+			w.b.WriteByte('\n')
+		}
+		fmt.Fprintf(&w.b, "# %d %s\n", line, quote(file))
+		w.file, w.line, w.col = file, line, 0
+		w.last = nil
+	}
+	for w.line < line {
+		w.b.WriteByte('\n')
+		w.line++
+		w.col = 0
+		w.last = nil
+	}
+
+	if !t.expanded && t.col > w.col {
+		// the tabs of the source are kept so that the caret of an error is
+		// placed the same as under the source line
+		line := t.src.line(t.line)
+		for ; w.col < t.col; w.col++ {
+			if w.col < len(line) && line[w.col] == '\t' {
+				w.b.WriteByte('\t')
+			} else {
+				w.b.WriteByte(' ')
+			}
+		}
+	} else if w.last != nil && (t.space || needSpace(w.last, t)) {
+		w.b.WriteByte(' ')
+		w.col++
+	}
+
+	w.b.WriteString(t.text)
+	w.col += len(t.text)
+	w.last = t
+}
+
+// needSpace reports whether a and b written next to each other would be read as
+// other tokens.
+func needSpace(a *ppToken, b *ppToken) bool {
+	if strings.HasSuffix(a.text, "/") && (strings.HasPrefix(b.text, "/") || strings.HasPrefix(b.text, "*")) {
+		return true
+	}
+
+	_, n := scan(a.text + b.text)
+	return n != len(a.text)
+}
+
+func (w *writer) String() string {
+	if w.col > 0 {
+		w.b.WriteByte('\n')
+		w.col = 0
+	}
+
+	return w.b.String()
+}
+
+// evaluator evaluates the constant expression of #if with the precedence of C.
+// skip is set while an operand which is not evaluated, such as the right of
+// `0 &&`, is parsed.
+type evaluator struct {
+	tokens    []*ppToken
+	pos       int
+	directive *ppToken
+	skip      bool
+}
+
+// value is an integer of #if, which has the type intmax_t or uintmax_t.
+type value struct {
+	v        int64
+	unsigned bool
+}
+
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (e *evaluator) consume(op string) bool {
+	if e.pos < len(e.tokens) && e.tokens[e.pos].is(op) {
+		e.pos++
+		return true
+	}
+
+	return false
+}
+
+func (e *evaluator) errorf(format string, a ...interface{}) error {
+	t := e.directive
+	if e.pos < len(e.tokens) {
+		t = e.tokens[e.pos]
+	}
+
+	return errorAt(t, format, a...)
+}
+
+// operand parses an operand by parse, which is not evaluated when skip is set.
+func (e *evaluator) operand(skip bool, parse func() (value, error)) (value, error) {
+	old := e.skip
+	e.skip = old || skip
+	v, err := parse()
+	e.skip = old
+
+	return v, err
+}
+
+func (e *evaluator) conditional() (value, error) {
+	c, err := e.binary(0)
+	if err != nil || !e.consume("?") {
+		return c, err
+	}
+
+	a, err := e.operand(c.v == 0, e.conditional)
+	if err != nil {
+		return value{}, err
+	}
+	if !e.consume(":") {
+		return value{}, e.errorf("expected ':' in #%s", e.directive.text)
+	}
+	b, err := e.operand(c.v != 0, e.conditional)
+	if err != nil {
+		return value{}, err
+	}
+
+	v := b
+	if c.v != 0 {
+		v = a
+	}
+	v.unsigned = a.unsigned || b.unsigned
+	return v, nil
+}
+
+func (e *evaluator) binary(level int) (value, error) {
+	if level == len(binaryLevels) {
+		return e.unary()
+	}
+
+	l, err := e.binary(level + 1)
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		op := ""
+		for _, v := range binaryLevels[level] {
+			if e.consume(v) {
+				op = v
+				break
+			}
+		}
+		if op == "" {
+			return l, nil
+		}
+
+		// the right of `0 &&` and `1 ||` is not evaluated
+		skip := (op == "&&" && l.v == 0) || (op == "||" && l.v != 0)
+		r, err := e.operand(skip, func() (value, error) {
+			return e.binary(level + 1)
+		})
+		if err != nil {
+			return value{}, err
+		}
+
+		// the operands are converted to unsigned if either is unsigned,
+		// except for the shifts and the logical operators
+		unsigned := l.unsigned || r.unsigned
+		switch op {
+		case "||":
+			l = value{v: boolInt(l.v != 0 || r.v != 0)}
+		case "&&":
+			l = value{v: boolInt(l.v != 0 && r.v != 0)}
+		case "|":
+			l = value{l.v | r.v, unsigned}
+		case "^":
+			l = value{l.v ^ r.v, unsigned}
+		case "&":
+			l = value{l.v & r.v, unsigned}
+		case "==":
+			l = value{v: boolInt(l.v == r.v)}
+		case "!=":
+			l = value{v: boolInt(l.v != r.v)}
+		case "<":
+			l = value{v: boolInt(less(l, r))}
+		case "<=":
+			l = value{v: boolInt(!less(r, l))}
+		case ">":
+			l = value{v: boolInt(less(r, l))}
+		case ">=":
+			l = value{v: boolInt(!less(l, r))}
+		case "<<":
+			l.v <<= uint64(r.v)
+		case ">>":
+			if l.unsigned {
+				l.v = int64(uint64(l.v) >> uint64(r.v))
+			} else {
+				l.v >>= uint64(r.v)
+			}
+		case "+":
+			l = value{l.v + r.v, unsigned}
+		case "-":
+			l = value{l.v - r.v, unsigned}
+		case "*":
+			l = value{l.v * r.v, unsigned}
+		case "/", "%":
+			if r.v == 0 {
+				if e.skip {
+					l = value{0, unsigned}
+					continue
+				}
+				return value{}, errorAt(e.tokens[e.pos-1], "division by zero in #%s", e.directive.text)
+			}
+			l = divide(op, l, r, unsigned)
+		}
+	}
+}
+
+// less reports whether l < r, compared as unsigned if either is unsigned.
+func less(l value, r value) bool {
+	if l.unsigned || r.unsigned {
+		return uint64(l.v) < uint64(r.v)
+	}
+	return l.v < r.v
+}
+
+// divide returns l / r or l % r for op, where r is not 0.
+func divide(op string, l value, r value, unsigned bool) value {
+	if unsigned {
+		if op == "/" {
+			return value{int64(uint64(l.v) / uint64(r.v)), true}
+		}
+		return value{int64(uint64(l.v) % uint64(r.v)), true}
+	}
+
+	if op == "/" {
+		return value{v: l.v / r.v}
+	}
+	return value{v: l.v % r.v}
+}
+
+func (e *evaluator) unary() (value, error) {
+	for _, op := range []string{"+", "-", "~", "!"} {
+		if !e.consume(op) {
+			continue
+		}
+
+		v, err := e.unary()
+		if err != nil {
+			return value{}, err
+		}
+		switch op {
+		case "-":
+			v.v = -v.v
+		case "~":
+			v.v = ^v.v
+		case "!":
+			v = value{v: boolInt(v.v == 0)}
+		}
+		return v, nil
+	}
+
+	return e.primary()
+}
+
+func (e *evaluator) primary() (value, error) {
+	if e.consume("(") {
+		v, err := e.conditional()
+		if err != nil {
+			return value{}, err
+		}
+		if !e.consume(")") {
+			return value{}, e.errorf("missing ')' in expression")
+		}
+		return v, nil
+	}
+
+	if e.pos >= len(e.tokens) {
+		return value{}, e.errorf("#%s with no expression", e.directive.text)
+	}
+	t := e.tokens[e.pos]
+	switch t.kind {
+	case ppNumber:
+		s := t.text
+		v, _, err := util.ParseInt(&s)
+		if err != nil {
+			return value{}, errorAt(t, "%s", err)
+		}
+		unsigned, _ := util.ParseIntSuffix(&s)
+		if s != "" {
+			return value{}, errorAt(t, "invalid integer constant %q in #%s", t.text, e.directive.text)
+		}
+		e.pos++
+		// a constant too large for intmax_t is uintmax_t
+		return value{int64(v), unsigned || v > math.MaxInt64}, nil
+	case ppChar:
+		s := t.text[strings.IndexByte(t.text, '\''):]
+		v, err := util.ParseChar(&s)
+		if err != nil {
+			return value{}, errorAt(t, "%s", err)
+		}
+		e.pos++
+		return value{v: int64(v)}, nil
+	case ppIdent:
+		// an identifier which is not a macro is 0
+		e.pos++
+		return value{}, nil
+	}
+
+	return value{}, errorAt(t, "token %q is not valid in preprocessor expressions", t.text)
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
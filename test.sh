@@ -9,6 +9,47 @@ cat <<EOF > tmp/p.c
 #include <stdio.h>
 void p(int v) { printf("%d\n", v); }
 EOF
+cat <<EOF > tmp/fp.c
+#include <stdarg.h>
+int ext_value = 42;
+long ext_arr[3] = {1, 2, 3};
+extern int gcount __attribute__((weak));
+int read_gcount() { return gcount; }
+extern int sglobal __attribute__((weak));
+int has_sglobal() { return &sglobal != 0; }
+int sfn() __attribute__((weak));
+int has_sfn() { return sfn != 0; }
+int vdfirst(double a, int n, ...) {
+    va_list ap;
+    va_start(ap, n);
+    for (int i = 0; i < n; i++) a += va_arg(ap, double);
+    va_end(ap);
+    return a;
+}
+int fsum(double a, int b, double c) { return a + b + c; }
+int fmix(int a, double b, int c, double d, int e, double f) { return a * b + c * d + e * f; }
+int vsum(int n, ...) __attribute__((weak));
+int vsum8() { return vsum(8, 1, 2, 3, 4, 5, 6, 7, 8); }
+double vdsum(int n, ...) __attribute__((weak));
+int vdsum10() { return vdsum(10, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, 10.5); }
+EOF
+mkdir -p tmp/inc
+cat <<EOF > tmp/inc/twice.h
+#ifndef TWICE_H
+#define TWICE_H
+#define TWICE(x) ((x) * 2)
+int twice_line() { return __LINE__; }
+#endif
+EOF
+cat <<EOF > tmp/local.h
+#include "inc/twice.h"
+#define LOCAL 5
+EOF
+cat <<EOF > tmp/pp.c
+#include "inc/twice.h"
+#define ONE 1
+int main() { return TWICE(ONE); }
+EOF
 cat <<EOF > tmp/alloc4.c
 #include <stdlib.h>
 void alloc4(int **base, int a, int b, int c, int d) {
@@ -30,17 +71,117 @@ function run() {
         return
     fi
 
-    gcc -g -O0 -o a a.s one.c two.c p.c alloc4.c
+    gcc -g -O0 -o a a.s one.c two.c p.c alloc4.c fp.c
     ./a
 }
 
 function check() {
     expected="$1"
+    shift
+    input="$(cat -)"
+
+    run "$@" "$input"
+    actual="$?"
+
+    echo "---"
+    if [ "$expected" = "$actual" ]; then
+        echo "$input => $actual"
+    else
+        echo "$input => $actual, but want $expected"
+        exit 1
+    fi
+}
+
+function check_error() {
     input="$(cat -)"
 
-    run "$input"
+    cd "$CURRENT_DIR"/tmp
+    ../bin/c8go "$input" > a.s
     actual="$?"
 
+    echo "---"
+    if [ "$actual" = 1 ]; then
+        echo "$input => compile error"
+    else
+        echo "$input => $actual, but want compile error"
+        exit 1
+    fi
+}
+
+function check_error_at() {
+    expected="$1"
+    input="$(cat -)"
+
+    cd "$CURRENT_DIR"/tmp
+    actual="$(../bin/c8go "$input" | sed -n 2p | cut -d ' ' -f 1)"
+
+    echo "---"
+    if [ "$expected" = "$actual" ]; then
+        echo "$input => error at $actual"
+    else
+        echo "$input => error at $actual, but want $expected"
+        exit 1
+    fi
+}
+
+function check_errors() {
+    expected="$1"
+    shift
+    input="$(cat -)"
+
+    cd "$CURRENT_DIR"/tmp
+    ../bin/c8go "$@" "$input" > a.s
+    status="$?"
+    actual="$(grep -c '^compile error:' a.s)"
+
+    echo "---"
+    if [ "$status" = 1 ] && [ "$expected" = "$actual" ]; then
+        echo "$input => $actual errors"
+    else
+        echo "$input => $actual errors, exit $status, but want $expected errors"
+        exit 1
+    fi
+}
+
+function check_error_size() {
+    max="$1"
+    input="$(cat -)"
+
+    cd "$CURRENT_DIR"/tmp
+    actual="$(../bin/c8go "$input" | wc -c)"
+
+    echo "---"
+    if [ "$actual" -le "$max" ]; then
+        echo "${#input} bytes of input => $actual bytes of errors"
+    else
+        echo "${#input} bytes of input => $actual bytes of errors, but want at most $max"
+        exit 1
+    fi
+}
+
+function check_error_caret() {
+    expected="$1"
+    input="$(cat -)"
+
+    cd "$CURRENT_DIR"/tmp
+    actual="$(../bin/c8go "$input" | grep '\^$')"
+
+    echo "---"
+    if [ "$expected" = "$actual" ]; then
+        echo "$input => $actual"
+    else
+        echo "$input => $actual, but want $expected"
+        exit 1
+    fi
+}
+
+function check_error_token() {
+    expected="$1"
+    input="$(cat -)"
+
+    cd "$CURRENT_DIR"/tmp
+    actual="$(../bin/c8go "$input" | grep -o '"[^"]*" (TK_[A-Z]*)')"
+
     echo "---"
     if [ "$expected" = "$actual" ]; then
         echo "$input => $actual"
@@ -50,6 +191,22 @@ function check() {
     fi
 }
 
+function check_preprocess() {
+    expected="$1"
+    shift
+
+    cd "$CURRENT_DIR"/tmp
+    actual="$(../bin/c8go -E "$@")"
+
+    echo "---"
+    if [ "$expected" = "$actual" ]; then
+        echo "$* => preprocessed"
+    else
+        echo "$* => $actual, but want $expected"
+        exit 1
+    fi
+}
+
 echo "int main() { 0; }" | check 0
 echo "int main() { 42; }" | check 42
 echo "int main() { 5+20-4; }" | check 21
@@ -167,7 +324,7 @@ int sum(int x, int y, int z) { return (x + y) * z; } int main() { return sum(10,
 EOF
 
 check 10 << EOF
-int f(int x) { return x - 10; } int main() { x = 23; return f(x - 3); }
+int f(int x) { return x - 10; } int main() { int x; x = 23; return f(x - 3); }
 EOF
 
 check 120 << EOF
@@ -195,10 +352,10 @@ check 3 << EOF
 int main() {
     int x;
     int y;
-    int z;
+    int *z;
     x = 3;
     y = 5;
-    z = &y + 8;
+    z = &y + 1;
     return *z;
 }
 EOF
@@ -247,3 +404,2394 @@ int main() {
     return a[1];
 }
 EOF
+
+check 2 << EOF
+int main() { return 6 & 3; }
+EOF
+
+check 7 << EOF
+int main() { return 6 | 3; }
+EOF
+
+check 5 << EOF
+int main() { return 6 ^ 3; }
+EOF
+
+check 10 << EOF
+int main() { return ~-11; }
+EOF
+
+check 40 << EOF
+int main() { return 5 << 3; }
+EOF
+
+check 6 << EOF
+int main() {
+    int a;
+    a = 100;
+    return a >> 4;
+}
+EOF
+
+check 1 << EOF
+int main() { return -16 >> 4 == -1; }
+EOF
+
+check 1 << EOF
+int main() { return 1 | 4 ^ 6 & 3 << 1 + 1; }
+EOF
+
+check 0 << EOF
+int main() { return 4 & 6 == 6; }
+EOF
+
+check 2 << EOF
+int main() { return 17 % 5; }
+EOF
+
+check 1 << EOF
+int main() { return -7 % 3 == -1; }
+EOF
+
+check 1 << EOF
+int main() { return 7 % -3; }
+EOF
+
+check 1 << EOF
+int main() {
+    int a;
+    a = 23;
+    return a % 10 * 3 / 2 % 3;
+}
+EOF
+
+check 2 << EOF
+int main() { return 40 / 5 / 4; }
+EOF
+
+check_error << EOF
+int main() { return 1 / 0; }
+EOF
+
+check_error << EOF
+int main() { return 1 % 0; }
+EOF
+
+check 3 << EOF
+int main() {
+    int a;
+    a = 5;
+    a += 3;
+    a -= 1;
+    a *= 6;
+    a /= 2;
+    a %= 16;
+    return a - 2;
+}
+EOF
+
+check 61 << EOF
+int main() {
+    int a;
+    a = 7;
+    a <<= 4;
+    a >>= 1;
+    a |= 6;
+    a ^= 3;
+    a &= 61;
+    return a;
+}
+EOF
+
+check 10 << EOF
+int main() {
+    int a;
+    int b;
+    a = 3;
+    b = (a += 2) + a;
+    return b + (a = 1) - a;
+}
+EOF
+
+check 11 << EOF
+int main() {
+    int a;
+    int b;
+    a = 5;
+    b = a++;
+    return a + b;
+}
+EOF
+
+check 10 << EOF
+int main() {
+    int a;
+    int b;
+    a = 5;
+    b = ++a;
+    b = b - a--;
+    return a + b + --a + 1;
+}
+EOF
+
+check 10 << EOF
+int main() {
+    int i;
+    int s;
+    i = 0;
+    s = 0;
+    while (i < 5) s += i++;
+    return s;
+}
+EOF
+
+check 8 << EOF
+int main() {
+    int *a;
+    int *b;
+    alloc4(&a, 1, 2, 4, 8);
+    b = a;
+    b += 3;
+    return *b;
+}
+EOF
+
+check 8 << EOF
+int main() {
+    int *a;
+    int *b;
+    alloc4(&a, 1, 2, 4, 8);
+    b = a;
+    b++;
+    ++b;
+    *b += 2;
+    b--;
+    return *b + *(a + 2);
+}
+EOF
+
+check 9 << EOF
+int main() {
+    int *a;
+    int *b;
+    alloc4(&a, 1, 2, 4, 8);
+    b = a + 3;
+    *b++;
+    *(--b) += 1;
+    return *b;
+}
+EOF
+
+check 7 << EOF
+int main() {
+    int a[3];
+    a[1] = 3;
+    a[1] += 4;
+    return a[1]++;
+}
+EOF
+
+check 12 << EOF
+int main() { int *a; int *b; int c; alloc4(&a, 1, 2, 4, 8); b = a; c = *b++; return c * 10 + *b; }
+EOF
+
+check 84 << EOF
+int main() { int *a; int *b; int c; alloc4(&a, 1, 2, 4, 8); b = a + 3; c = *b--; return c * 10 + *b; }
+EOF
+
+check_error << EOF
+int main() { 1 += 2; }
+EOF
+
+check_error << EOF
+int main() { int a; a = 1; a++++; }
+EOF
+
+check 5 << EOF
+int main() { return 1 ? 5 : 7; }
+EOF
+
+check 7 << EOF
+int main() { return 0 ? 5 : 7; }
+EOF
+
+check 3 << EOF
+int main() {
+    int a;
+    a = 2;
+    return a == 1 ? 1 : a == 2 ? 3 : 4;
+}
+EOF
+
+check 9 << EOF
+int main() {
+    int a;
+    int b;
+    a = 0;
+    a ? b = 1 : (b = 9);
+    return b;
+}
+EOF
+
+check 14 << EOF
+int main() {
+    int a;
+    a = 4;
+    return (a > 3 ? a : 3) + (a > 5 ? a : 10);
+}
+EOF
+
+check 8 << EOF
+int main() {
+    int *a;
+    int b;
+    alloc4(&a, 1, 2, 4, 8);
+    b = 1;
+    return *((b ? a : 0) + 3);
+}
+EOF
+
+check 20 << EOF
+int f(int x) { return x < 2 ? x : f(x - 1) + f(x - 2); }
+int main() { return f(5) * 4; }
+EOF
+
+check_error << EOF
+int main() { int a; a = 0; a ? 1 : a = 9; }
+EOF
+
+check 3 << EOF
+int main() { return (1, 2, 3); }
+EOF
+
+check 55 << EOF
+int main() {
+    int i;
+    int s;
+    s = 0;
+    for (i = 1; i <= 10; i++) s += i;
+    return s;
+}
+EOF
+
+check 6 << EOF
+int main() {
+    int i;
+    int j;
+    int s;
+    s = 0;
+    for (i = 0, j = 10; i < j; i++, j--) s = s * 2 + (j - i == 2);
+    return s + i;
+}
+EOF
+
+check 5 << EOF
+int main() {
+    int i;
+    i = 0;
+    for (;;) {
+        i++;
+        if (i == 5) return i;
+    }
+}
+EOF
+
+check 10 << EOF
+int main() {
+    int a;
+    int b;
+    a = (b = 3, b + 7);
+    return a;
+}
+EOF
+
+check 9 << EOF
+int main() { return two((1, 4), 5); }
+EOF
+
+check 8 << EOF
+int main() {
+    int *a;
+    int b;
+    alloc4(&a, 1, 2, 4, 8);
+    return *((b = 0, a) + 3);
+}
+EOF
+
+check 5 << EOF
+int main() { return (int)(1 << 32) + 5; }
+EOF
+
+check 1 << EOF
+int main() { return (int)((1 << 32) - 1) == -1; }
+EOF
+
+check 3 << EOF
+int main() { return -(int)-3; }
+EOF
+
+check 1 << EOF
+int main() {
+    int a;
+    a = 7;
+    return (int)(a + 1) == 8;
+}
+EOF
+
+check 8 << EOF
+int main() {
+    int *a;
+    alloc4(&a, 1, 2, 4, 8);
+    return *((int *)a + 3);
+}
+EOF
+
+check 7 << EOF
+int main() {
+    int *p;
+    p = (int *)malloc(16);
+    *p = 3;
+    *(p + 1) = 4;
+    return *p + *(p + 1);
+}
+EOF
+
+check 4 << EOF
+int main() {
+    int **p;
+    int *q;
+    alloc4(&q, 1, 2, 4, 8);
+    p = (int **)malloc(8);
+    *p = q;
+    return *(*p + 2);
+}
+EOF
+
+check 1 << EOF
+int main() {
+    int a;
+    a = 2147483647;
+    a = a + 1;
+    return a < 0;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    int a;
+    a = 65536;
+    return a * a == 0;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    int a;
+    a = 1;
+    a <<= 31;
+    a >>= 31;
+    return a == -1;
+}
+EOF
+
+check 1 << EOF
+int main() { return two(-1, 0) == -1; }
+EOF
+
+check 4 << EOF
+int main() {
+    int *a;
+    alloc4(&a, 1, 2, 4, 8);
+    *(a + 1) = 9;
+    return *(a + 2);
+}
+EOF
+
+check 2 << EOF
+int main() {
+    int *a;
+    alloc4(&a, 1, 2, 4, 8);
+    a[0] = a[1] + a[2];
+    return a[3] + a[0] - a[1] - a[2] - 6;
+}
+EOF
+
+check 12 << EOF
+int main() {
+    int a[10];
+    int i;
+    int *p;
+    for (i = 0; i < 10; i++) a[i] = i;
+    p = a;
+    p += 3;
+    return *p + a[9];
+}
+EOF
+
+check 3 << EOF
+int main() {
+    int a[10];
+    int *p;
+    int *q;
+    p = a + 2;
+    q = &a[5];
+    return q - p;
+}
+EOF
+
+check 7 << EOF
+int main() {
+    int *a[2];
+    int x;
+    x = 7;
+    a[1] = &x;
+    return *a[1];
+}
+EOF
+
+check 16 << EOF
+int main() {
+    int *a[2];
+    return sizeof(a);
+}
+EOF
+
+check 8 << EOF
+int main() {
+    int *p;
+    return sizeof(p);
+}
+EOF
+
+check 5 << EOF
+int f(int x) {
+    int a[100];
+    a[99] = x;
+    return a[99];
+}
+int main() {
+    int b[100];
+    b[0] = 1;
+    return f(4) + b[0];
+}
+EOF
+
+check 6 << EOF
+int sum(int *p, int n) {
+    int s;
+    s = 0;
+    while (n > 0) s += p[--n];
+    return s;
+}
+int main() {
+    int a[3];
+    a[0] = 1;
+    a[1] = 2;
+    a[2] = 3;
+    return sum(a, 3);
+}
+EOF
+
+check 18 << EOF
+int main() {
+    long a;
+    short b;
+    unsigned long long c;
+    return sizeof(a) + sizeof(b) + sizeof(c);
+}
+EOF
+
+check 24 << EOF
+int main() { return sizeof(1L) + sizeof(1) + sizeof(1U) + sizeof(1ull) - sizeof(4294967296) + sizeof(sizeof(1)); }
+EOF
+
+check 1 << EOF
+int main() {
+    short s;
+    s = 65535;
+    return s == -1;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned short s;
+    s = -1;
+    return s == 65535;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    short s;
+    return (s = 70000) == 4464;
+}
+EOF
+
+check 3 << EOF
+int main() { short s; int r; s = -32768; r = s--; return (r == -32768) + (s == 32767) * 2; }
+EOF
+
+check 3 << EOF
+int main() { unsigned short s; int r; s = 65535; r = s++; return (r == 65535) + (s == 0) * 2; }
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned int a;
+    a = -1;
+    return a > 0;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned int a;
+    a = -2;
+    return a / 2 == 2147483647;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned a;
+    int b;
+    a = -8;
+    b = -8;
+    return (a >> 28) + (b >> 28) == 14;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned int a;
+    a = 4294967295;
+    a += 2;
+    return a;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    long a;
+    a = 1;
+    a <<= 40;
+    return (a >> 40) == 1;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    long x;
+    x = 4294967296;
+    return x / 4294967296;
+}
+EOF
+
+check 1 << EOF
+int main() { return 4294967296L == 4294967296; }
+EOF
+
+check 0 << EOF
+int main() { return -1 < 1U; }
+EOF
+
+check 1 << EOF
+int main() { return -1 < 1L; }
+EOF
+
+check 1 << EOF
+int main() { return -1L < 1U; }
+EOF
+
+check 0 << EOF
+int main() { return -1 < 1UL; }
+EOF
+
+check 1 << EOF
+int main() { return (unsigned long)-1 > 0; }
+EOF
+
+check 1 << EOF
+int main() { return (unsigned)-1 % 10 == 5; }
+EOF
+
+check 1 << EOF
+int main() { return -7 / 2U == 2147483644; }
+EOF
+
+check 1 << EOF
+int main() { return (short)65537 == 1; }
+EOF
+
+check 2 << EOF
+int main() {
+    int a;
+    long b;
+    a = -1;
+    b = a;
+    return (b == -1) + (b < 0);
+}
+EOF
+
+check 1 << EOF
+int main() {
+    unsigned a;
+    long b;
+    a = -1;
+    b = a;
+    return b == 4294967295;
+}
+EOF
+
+check 2 << EOF
+long f(long x) { return x * 2; }
+int main() { return f(4294967296) / 4294967296; }
+EOF
+
+check 1 << EOF
+short g(short x) { return x + 1; }
+int main() { return g(32767) == -32768; }
+EOF
+
+check 1 << EOF
+unsigned long h(unsigned x, long y) { return x + y; }
+int main() { return h(4294967295, 1) == 4294967296; }
+EOF
+
+check 3 << EOF
+int main() {
+    long signed int a;
+    int long unsigned b;
+    short int c;
+    a = 1;
+    b = 1;
+    c = 1;
+    return a + b + c;
+}
+EOF
+
+check_error << EOF
+int main() { short long a; return 0; }
+EOF
+
+check_error << EOF
+int main() { signed unsigned a; return 0; }
+EOF
+
+check 1 << EOF
+int main() {
+    _Bool b;
+    b = 2;
+    return b;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    _Bool b;
+    b = 256;
+    return b;
+}
+EOF
+
+check 1 << EOF
+int main() { return (_Bool)-1 + (_Bool)0; }
+EOF
+
+check 1 << EOF
+int main() { return (_Bool)4294967296; }
+EOF
+
+check 11 << EOF
+int main() { _Bool b; int r; b = 1; r = b++; return r * 10 + b; }
+EOF
+
+check 1 << EOF
+int main() { _Bool b; int r; b = 0; r = b--; return r * 10 + b; }
+EOF
+
+check 3 << EOF
+int main() {
+    _Bool a[3];
+    return sizeof(a);
+}
+EOF
+
+check 1 << EOF
+int main() {
+    _Bool b;
+    b = 1;
+    b += 1;
+    return b;
+}
+EOF
+
+check 1 << EOF
+int main() {
+    _Bool b;
+    b = 0;
+    b--;
+    return b;
+}
+EOF
+
+check 9 << EOF
+int main() {
+    _Bool b;
+    int *p;
+    int x;
+    p = 0;
+    b = p;
+    p = &x;
+    return b * 10 + (b = p) * 10 - b;
+}
+EOF
+
+check 2 << EOF
+int main() {
+    _Bool a;
+    _Bool b;
+    a = 1;
+    b = 1;
+    return a + b;
+}
+EOF
+
+check 1 << EOF
+_Bool f(int x) { return x; }
+int main() { return f(256); }
+EOF
+
+check 0 << EOF
+int main() {
+    _Bool b;
+    b = 3;
+    return ~b == -1;
+}
+EOF
+
+check_error << EOF
+int main() { _Bool int b; return 0; }
+EOF
+
+check 3 << EOF
+int main() { double a; a = 1.5; return a * 2; }
+EOF
+
+check 2 << EOF
+int main() { float a; a = 2.75f; return a; }
+EOF
+
+check 7 << EOF
+int main() { double a; a = 7.9; int b; b = a; return b; }
+EOF
+
+check 1 << EOF
+int main() { return 0.1 + 0.2 > 0.3; }
+EOF
+
+check 1 << EOF
+int main() { return 1.0 / 3 * 3 == 1; }
+EOF
+
+check 12 << EOF
+int main() { double a; a = .5e1; float b; b = 7e0f; return a + b; }
+EOF
+
+check 5 << EOF
+int main() { double a; a = 10; a /= 4; a *= 2; return a; }
+EOF
+
+check 4 << EOF
+int main() { int a; a = 9; a *= 0.5; return a; }
+EOF
+
+check 1 << EOF
+int main() { double a; a = 0.5; if (a) return 1; return 0; }
+EOF
+
+check 0 << EOF
+int main() { double a; a = 0.0; return a ? 1 : 0; }
+EOF
+
+check 3 << EOF
+int main() { double a; a = 0.25; int i; i = 0; while (a) { a = a - 0.125; i = i + 1; } return i + 1; }
+EOF
+
+check 8 << EOF
+int main() { double d; return sizeof(d) + sizeof(1.0f) * 0; }
+EOF
+
+check 4 << EOF
+int main() { float f; return sizeof(f); }
+EOF
+
+check 8 << EOF
+int main() { long double d; return sizeof(d); }
+EOF
+
+check 1 << EOF
+int main() { float f; f = 0.1f; double d; d = 0.1; return f != d; }
+EOF
+
+check 1 << EOF
+int main() { return -1.5 < -1; }
+EOF
+
+check 254 << EOF
+int main() { double d; d = 254.9; return (unsigned short)d; }
+EOF
+
+check 1 << EOF
+int main() { unsigned long a; a = 0; a = a - 1; double d; d = a; return d > 18446744073709550000.0; }
+EOF
+
+check 1 << EOF
+int main() { double d; d = 18446744073709549568.0; unsigned long a; a = d; return a / 2048 == 9007199254740991; }
+EOF
+
+check 1 << EOF
+int main() { _Bool b; b = 0.5; return b; }
+EOF
+
+check 9 << EOF
+int main() { return fsum(2.5, 3, 3.5f); }
+EOF
+
+check 38 << EOF
+int main() { return fmix(2, 1.5, 3, 2.0, 4, 7.25); }
+EOF
+
+check 6 << EOF
+double half(double a) { return a / 2; }
+int main() { return half(12.5); }
+EOF
+
+check 7 << EOF
+float add(float a, float b) { return a + b; }
+int main() { return add(3.25f, 3.75f); }
+EOF
+
+check 21 << EOF
+double fib(int n) { if (n < 2) return n; return fib(n - 1) + fib(n - 2); }
+int main() { return fib(8); }
+EOF
+
+check 10 << EOF
+int avg(int a, double b, float c) { return (a + b + c) / 3 * 2; }
+int main() { return avg(4, 5.5, 5.5f); }
+EOF
+
+check 6 << EOF
+int main() { double d; d = 3.0 / 0.5; return d; }
+EOF
+
+check 6 << EOF
+int main() { double d; d = 3.0; d /= 0.5; return d; }
+EOF
+
+check 8 << EOF
+int main() { int x; x = 4; x /= 0.5; return x; }
+EOF
+
+check 1 << EOF
+int main() { double d; d = 1.0 / 0; return d > 1000000; }
+EOF
+
+check 6 << EOF
+int main() { double d; double r; d = 2.5; r = d++; return r + d; }
+EOF
+
+check_error << EOF
+int main() { double a; a = 1.0; return a % 2; }
+EOF
+
+check_error << EOF
+int main() { float a; a = 1; return ~a; }
+EOF
+
+check_error << EOF
+int main() { int a; a = 1; a <<= 1.0; return a; }
+EOF
+
+check_error << EOF
+int main() { float double a; return 0; }
+EOF
+
+check 5 << EOF
+int add(int a, int b) { return a + b; }
+int main() { int (*f)(int, int); f = add; return f(2, 3); }
+EOF
+
+check 6 << EOF
+int sub(int a, int b) { return a - b; }
+int main() { int (*f)(int, int); f = &sub; return (*f)(9, 3); }
+EOF
+
+check 21 << EOF
+int add(int a, int b) { return a + b; }
+int mul(int c, int d) { return c * d; }
+int main() { int (*ops[2])(int, int); ops[0] = add; ops[1] = mul; return ops[0](3, 4) * ops[1](1, 3); }
+EOF
+
+check 12 << EOF
+int twice(int y) { return y * 2; }
+int apply(int (*f)(int), int x) { return f(f(x)); }
+int main() { return apply(twice, 3); }
+EOF
+
+check 1 << EOF
+int one2() { return 1; }
+int main() { int (*f)(); f = one2; return f == one2; }
+EOF
+
+check 7 << EOF
+double half(double x) { return x / 2; }
+int main() { double (*f)(double); f = half; return f(14); }
+EOF
+
+check 8 << EOF
+int sq(int x) { return x * x; }
+int main() { int (*f)(int); int (**pp)(int); f = sq; pp = &f; return (**pp)(2) + sizeof(f) - 4; }
+EOF
+
+check 3 << EOF
+int add(int a, int b) { return a + b; }
+int main() { long p; p = (long)add; return ((int (*)(int, int))p)(1, 2); }
+EOF
+
+check_error << EOF
+int main() { int a; a = 1; return a(2); }
+EOF
+
+check 10 << EOF
+int sum(int n, ...) { va_list ap; va_start(ap, n); int s; s = 0; int i; for (i = 0; i < n; i++) s += va_arg(ap, int); va_end(ap); return s; }
+int main() { return sum(4, 1, 2, 3, 4); }
+EOF
+
+check 36 << EOF
+int vsum(int n, ...) { va_list ap; va_start(ap, n); int s; s = 0; int i; for (i = 0; i < n; i++) s += va_arg(ap, int); va_end(ap); return s; }
+int main() { return vsum8(); }
+EOF
+
+check 55 << EOF
+double vdsum(int n, ...) { va_list ap; va_start(ap, n); double s; s = 0; int i; for (i = 0; i < n; i++) s += va_arg(ap, double); va_end(ap); return s; }
+int main() { return vdsum10(); }
+EOF
+
+check 9 << EOF
+long mix(int a, double b, ...) { __builtin_va_list ap; __builtin_va_start(ap, b); long x; x = va_arg(ap, long); double y; y = va_arg(ap, double); int *p; p = va_arg(ap, int *); return a + b + x + y + *p; }
+int main() { int v; v = 3; return mix(1, 1.5, 2, 1.5, &v); }
+EOF
+
+check 24 << EOF
+int sizes(int n, ...) { va_list ap; return sizeof(ap); }
+int main() { return sizes(0); }
+EOF
+
+check 3 << EOF
+int count(int n, ...) { va_list ap; va_start(ap, n); int a; a = va_arg(ap, int); va_list *q; int b; b = va_arg(ap, int); va_end(ap); return a + b; }
+int main() { return count(2, 1, 2); }
+EOF
+
+check_error << EOF
+int f(int n) { va_list ap; va_start(ap, n); return 0; }
+int main() { return f(1); }
+EOF
+
+check_error << EOF
+int main() { va_end(); return 0; }
+EOF
+
+check_error << EOF
+int f(int n, ...) { va_list ap; va_start(ap, n); va_end(ap, n); return 0; }
+int main() { return f(1); }
+EOF
+
+check 6 << EOF
+int main() { return vdfirst(2.0, 2, 1.5, 2.5); }
+EOF
+
+check 3 << EOF
+int main() { return vdfirst(2.0, 1, 1.5f); }
+EOF
+
+check 6 << EOF
+int vdfirst(double a, int n, ...);
+int main() { return vdfirst(2, 2, 1.5, 2.5); }
+EOF
+
+check 3 << EOF
+int two(int, int);
+int main() { return two(1.9, 2); }
+EOF
+
+check 7 << EOF
+int add3(int a, int b, int c);
+int main() { return add3(1, 2, 4); }
+int add3(int a, int b, int c) { return a + b + c; }
+EOF
+
+check 5 << EOF
+double avg(int n, ...);
+int main() { return avg(3, 4.0, 5.0, 6.0); }
+double avg(int n, ...) { va_list ap; va_start(ap, n); double s; s = 0; int i; for (i = 0; i < n; i++) s += va_arg(ap, double); return s / n; }
+EOF
+
+check 2 << EOF
+int f(int a, ...) { va_list ap; va_start(ap, a); _Bool b; b = 1; short c; c = va_arg(ap, int); return c + b; }
+int main() { _Bool x; x = 1; return f(0, x); }
+EOF
+
+check_error << EOF
+int f(int) { return 0; }
+int main() { return f(1); }
+EOF
+
+check 3 << EOF
+int g;
+int main() { g = 3; return g; }
+EOF
+
+check 10 << EOF
+int arr[5];
+int set() { arr[2] = 4; arr[4] = 6; return 0; }
+int main() { set(); return arr[2] + arr[4] + arr[0]; }
+EOF
+
+check 7 << EOF
+int gcount;
+int main() { gcount = 7; return read_gcount(); }
+EOF
+
+check 0 << EOF
+static int sglobal;
+int main() { sglobal = 1; return has_sglobal(); }
+EOF
+
+check 1 << EOF
+int gglobal;
+extern int sglobal;
+int main() { return has_sglobal() == 0; }
+EOF
+
+check 5 << EOF
+static int sfn() { return 5; }
+int main() { return sfn() + has_sfn(); }
+EOF
+
+check 42 << EOF
+extern int ext_value;
+int main() { return ext_value; }
+EOF
+
+check 6 << EOF
+int main() { extern long ext_arr[3]; return ext_arr[0] + ext_arr[1] + ext_arr[2]; }
+EOF
+
+check 3 << EOF
+int counter() { static int n; n = n + 1; return n; }
+int main() { counter(); counter(); return counter(); }
+EOF
+
+check 9 << EOF
+int n;
+int counter() { static int c; c += 3; return c; }
+int main() { n = 100; counter(); counter(); return counter(); }
+EOF
+
+check 8 << EOF
+long g;
+long g;
+int main() { long *p; p = &g; *p = 8; return g + sizeof(g) - 8; }
+EOF
+
+check 4 << EOF
+static int f();
+int f() { return 4; }
+int main() { return f() + has_sfn() * 0; }
+EOF
+
+check 2 << EOF
+double d;
+int main() { d = 1.25; return d * 2; }
+EOF
+
+check_error << EOF
+static extern int g;
+int main() { return 0; }
+EOF
+
+check 6 << EOF
+int c;
+int counter() { static int c; c += 3; return c; }
+int main() { counter(); return counter(); }
+EOF
+
+check 5 << EOF
+const int x = 5;
+int main() { return x; }
+EOF
+
+check 139 << EOF
+const int x = 5;
+int main() { int *p; p = (int *)&x; *p = 1; return 0; }
+EOF
+
+check 7 << EOF
+int y = 3 + 4;
+int main() { return y; }
+EOF
+
+check 8 << EOF
+int y = 3;
+int main() { y = 8; return y; }
+EOF
+
+check 12 << EOF
+const long big = ((1L << 40) >> 38) * 3;
+int main() { return big; }
+EOF
+
+check 3 << EOF
+const double pi = 3.14159;
+int main() { return pi; }
+EOF
+
+check 6 << EOF
+float f = 1.5f * 4;
+int main() { return f; }
+EOF
+
+check 255 << EOF
+const unsigned short us = -1;
+int main() { return us & 255; }
+EOF
+
+check 1 << EOF
+int *np = 0;
+int main() { return np == 0; }
+EOF
+
+check 2 << EOF
+int t = 1 ? 2 : 3;
+int main() { return t; }
+EOF
+
+check 9 << EOF
+int g;
+int g = 9;
+int main() { return g; }
+EOF
+
+check 4 << EOF
+volatile int v;
+int main() { v = 4; return v; }
+EOF
+
+check 3 << EOF
+int main() { int a; a = 3; const int *p; p = &a; return *p; }
+EOF
+
+check 5 << EOF
+int main() { int a; int *const p; return 5; }
+EOF
+
+check 7 << EOF
+int main() { int a; int b; int *const *pp; int *q; q = &a; pp = &q; **pp = 7; return a; }
+EOF
+
+check 1 << EOF
+const int *cp;
+int main() { int a; a = 1; cp = &a; return *cp; }
+EOF
+
+check_error << EOF
+int main() { const int a; a = 1; return a; }
+EOF
+
+check_error << EOF
+int main() { int a; const int *p; p = &a; *p = 1; return a; }
+EOF
+
+check_error << EOF
+int main() { int a; int *const p; p = &a; return 0; }
+EOF
+
+check_error << EOF
+const int c = 1;
+int main() { c += 1; return c; }
+EOF
+
+check_error << EOF
+const int c = 1;
+int main() { c++; return c; }
+EOF
+
+check_error << EOF
+int main() { const long a; --a; return 0; }
+EOF
+
+check_error << EOF
+int a;
+int b = a;
+int main() { return b; }
+EOF
+
+check_error << EOF
+int g = 1;
+int g = 2;
+int main() { return g; }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(int *); }
+EOF
+
+check 4 << EOF
+int main() { return sizeof(int); }
+EOF
+
+check 2 << EOF
+int main() { return sizeof(unsigned short); }
+EOF
+
+check 1 << EOF
+int main() { return sizeof(_Bool); }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(long double); }
+EOF
+
+check 40 << EOF
+int main() { return sizeof(int (*)(int)) * 5; }
+EOF
+
+check 8 << EOF
+int main() { int a[10]; return sizeof(a + 1); }
+EOF
+
+check 40 << EOF
+int main() { int a[10]; return sizeof a; }
+EOF
+
+check 4 << EOF
+int main() { long *p; int *q; return sizeof(*q) + sizeof(p) - sizeof(long); }
+EOF
+
+check 16 << EOF
+int main() { return sizeof(int) * 4; }
+EOF
+
+check 3 << EOF
+int main() { int x; x = 3; sizeof(x = 5); return x; }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(1 ? 1 : 2L); }
+EOF
+
+check 4 << EOF
+int main() { short s; return sizeof(s + s); }
+EOF
+
+check 8 << EOF
+int main() { return _Alignof(double); }
+EOF
+
+check 2 << EOF
+int main() { short a[5]; return _Alignof(a); }
+EOF
+
+check 1 << EOF
+int main() { return _Alignof(_Bool) == sizeof(_Bool); }
+EOF
+
+check 24 << EOF
+int main() { return sizeof(va_list); }
+EOF
+
+check 7 << EOF
+int main() { return sizeof(const int) + 3; }
+EOF
+
+check 97 << EOF
+int main() { return 'a'; }
+EOF
+
+check 10 << EOF
+int main() { return '\n'; }
+EOF
+
+check 65 << EOF
+int main() { return '\x41'; }
+EOF
+
+check 8 << EOF
+int main() { return '\10'; }
+EOF
+
+check 0 << EOF
+int main() { return '\0'; }
+EOF
+
+check 1 << EOF
+int main() { return '\xff' == -1; }
+EOF
+
+check 1 << EOF
+int main() { return 'ab' == 24930; }
+EOF
+
+check 4 << EOF
+int main() { return sizeof('a'); }
+EOF
+
+check 39 << EOF
+int main() { return '\''; }
+EOF
+
+check 34 << EOF
+int main() { return '\"'; }
+EOF
+
+check 27 << EOF
+int main() { return '\e'; }
+EOF
+
+check 1 << EOF
+int main() { return 'abcd' == 1633837924; }
+EOF
+
+check 1 << EOF
+int main() { return '\t' + '\a' - '\b' - '\v' + 11 - '\r' + 13 - '\f' + 12 - 7; }
+EOF
+
+check 63 << EOF
+int main() { return '\?'; }
+EOF
+
+check_error << EOF
+int main() { return 'a; }
+EOF
+
+check_error << EOF
+int main() { return ''; }
+EOF
+
+check_error << EOF
+int main() { return '\x'; }
+EOF
+
+check_error << EOF
+int main() { return '\x100'; }
+EOF
+
+check_error << EOF
+int main() { return '\777'; }
+EOF
+
+check 255 << EOF
+int main() { return 0xff; }
+EOF
+
+check 26 << EOF
+int main() { return 0X1a; }
+EOF
+
+check 8 << EOF
+int main() { return 010; }
+EOF
+
+check 0 << EOF
+int main() { return 0; }
+EOF
+
+check 5 << EOF
+int main() { return 0b101; }
+EOF
+
+check 10 << EOF
+int main() { return 0B1010; }
+EOF
+
+check 4 << EOF
+int main() { return sizeof(0xffffffff) * (0xffffffff > 0); }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(4294967295); }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(2147483648); }
+EOF
+
+check 4 << EOF
+int main() { return sizeof(2147483647); }
+EOF
+
+check 1 << EOF
+int main() { return 0x7fffffff + 0 > 0; }
+EOF
+
+check 1 << EOF
+int main() { return 0xffffffffffffffff == -1; }
+EOF
+
+check 1 << EOF
+int main() { return 0xffffffffffffffff > 0; }
+EOF
+
+check 1 << EOF
+int main() { return 0x8000000000000000 > 0; }
+EOF
+
+check 1 << EOF
+int main() { return 18446744073709551615u > 0; }
+EOF
+
+check 1 << EOF
+int main() { return 9223372036854775807 > 0; }
+EOF
+
+check 8 << EOF
+int main() { return sizeof(1l) + sizeof(1u) * 0; }
+EOF
+
+check 1 << EOF
+int main() { return -1 < 0x7fffffffl; }
+EOF
+
+check 0 << EOF
+int main() { return -1 < 0xffffffffu; }
+EOF
+
+check 7 << EOF
+int main() { return 07 + 0x0 + 0b0; }
+EOF
+
+check_error << EOF
+int main() { return 18446744073709551616; }
+EOF
+
+check_error << EOF
+int main() { return 9223372036854775808; }
+EOF
+
+check_error << EOF
+int main() { return 08; }
+EOF
+
+check_error << EOF
+int main() { return 0b102; }
+EOF
+
+check_error << EOF
+int main() { return 0x; }
+EOF
+
+check_error << EOF
+int main() { return 12abc; }
+EOF
+
+check 3 << EOF
+int main() { // comment
+  return 3; // another
+}
+EOF
+
+check 4 << EOF
+int main() { /* block */ return /* inline */ 4; }
+EOF
+
+check 5 << EOF
+/*
+ * multi line
+ */
+int main() {
+  /* a */ int a; /* b
+  c */ a = 5;
+  return a; // last
+}
+EOF
+
+check 2 << EOF
+int main() { return 4 /* / */ / 2; }
+EOF
+
+check 6 << EOF
+int main() { return 3 * 2; } // trailing without newline
+EOF
+
+check 1 << EOF
+int main() { /* nested /* is not */ return 1; }
+EOF
+
+check 7 << EOF
+int main() { return 7; /**/ }
+EOF
+
+check_error << EOF
+int main() { return 0; } /* never closed
+EOF
+
+check_error << EOF
+int main() {
+  /* a */ int a; /* b
+  c */ a = ;
+}
+EOF
+
+check 3 << EOF
+int main() {
+	int a;
+	a = 3;
+	return a;
+}
+EOF
+
+check 4 << EOF
+int main() {
+  return 4;
+}
+
+EOF
+
+check 5 << EOF
+intmain(){	return	5;}
+EOF
+
+check 6 << EOF
+int main() {
+	// comment
+	return 6; /* c
+ */
+}
+EOF
+
+check_error << EOF
+int main() {
+		return 08;
+}
+EOF
+
+check 10 << EOF
+#define N 10
+int main() { return N; }
+EOF
+
+check 9 << EOF
+#define ADD(a, b) ((a) + (b))
+#define SQ(x) ADD(x, 0) * ADD(x, 0)
+int main() { return SQ(1 + 2); }
+EOF
+
+check 12 << EOF
+#define CAT(a, b) a ## b
+#define VAR(n) CAT(v, n)
+int main() {
+  int v1; int v12;
+  VAR(1) = 5;
+  CAT(v, 12) = 7;
+  return v1 + VAR(CAT(1, 2));
+}
+EOF
+
+check 2 << EOF
+#define CALL(f, ...) f(__VA_ARGS__)
+int main() { return two(CALL(one), CALL(two, 1, 0)); }
+EOF
+
+check 6 << EOF
+int main() {
+  int v; v = 2;
+#define v v * 3
+  return v;
+}
+EOF
+
+check 4 << EOF
+#define X 1
+#undef X
+#ifdef X
+int main() { return 3; }
+#else
+int main() { return 4; }
+#endif
+EOF
+
+check 2 << EOF
+#define A 2
+#if !defined(A)
+#error A is not defined
+#elif A == 1 || defined B
+int main() { return 1; }
+#elif defined A && (A << 2) - 6 == 2 && 'a' == 97
+int main() { return A; }
+#else
+int main() { return 3; }
+#endif
+EOF
+
+check 7 << EOF
+#if 0
+#if 1
+this is not compiled
+#error not reached
+#endif
+#elif 0x10 > 010 ? 0 : 1
+int main() { return 8; }
+#else
+int main() { return 7; }
+#endif
+EOF
+
+check 9 << EOF
+#define LINE __LINE__
+int main() {
+  return __STDC__ +
+    LINE + __LINE__;
+}
+EOF
+
+check 100 << EOF
+#line 100
+int main() { return __LINE__; }
+EOF
+
+check 13 << EOF
+#include "local.h"
+#include "local.h"
+int main() { return TWICE(LOCAL) - 1 + twice_line(); }
+EOF
+
+check 6 -I inc << EOF
+#include <twice.h>
+int main() { return TWICE(3); }
+EOF
+
+check_error << EOF
+#define MSG stop
+#error MSG here
+EOF
+
+check_error << EOF
+#if 1
+int main() { return 0; }
+EOF
+
+check_error << EOF
+#if 1
+#else
+#elif 1
+#endif
+EOF
+
+check_error << EOF
+#include <no_such_header.h>
+EOF
+
+check_error << EOF
+#define F(a, b) a
+int main() { return F(1); }
+EOF
+
+check_error << EOF
+#if 1 +
+#endif
+EOF
+
+check_preprocess '# 1 "<input>"
+
+int x = (1) + 2;' '#define X (1)
+int x = X + 2;'
+
+check_preprocess '# 1 "<input>"
+
+
+
+"a + b" x1 - -1' '#define STR(a) #a
+#define CAT(a, b) a ## b
+#define NEG(a) -a
+STR( a  +  b ) CAT(x, 1) NEG(-1)'
+
+check_preprocess '# 1 "pp.c"
+# 4 "inc/twice.h"
+int twice_line() { return 4       ; }
+# 3 "pp.c"
+int main() { return ((1) * 2) ; }' pp.c
+
+check 6 << EOF
+#include <stdio.h>
+#include <string.h>
+int main() { char buf[16]; sprintf(buf, "%d-%s", 42, "ab" "c"); return strlen(buf); }
+EOF
+
+check 7 << EOF
+#include <stdlib.h>
+#include <string.h>
+int main() { char *s; s = malloc(8); strcpy(s, "hi"); free(s); return abs(-7); }
+EOF
+
+check 1 << EOF
+#include <stdio.h>
+int main(void) { FILE *f; f = stdout; return fileno(f); }
+EOF
+
+check 14 << EOF
+struct point { int x; int y; };
+int main() { struct point p; struct point *q; q = &p; p.x = 3; q->y = 11; return p.x + p.y; }
+EOF
+
+check 24 << EOF
+struct s { char c; long l; int i; };
+int main() { return sizeof(struct s); }
+EOF
+
+check 8 << EOF
+union u { char c; long l; int i; };
+int main() { return sizeof(union u); }
+EOF
+
+check 68 << EOF
+union u { int i; char c[4]; };
+int main() { union u v; v.i = 0x41424344; return v.c[0]; }
+EOF
+
+check 9 << EOF
+struct list { struct list *next; int v; };
+int main() { struct list a, b; a.next = &b; b.v = 9; return a.next->v; }
+EOF
+
+check 7 << EOF
+struct s { int a; union { int b; char c; }; struct { int d; } in; };
+int main() { struct s x; x.b = 5; x.in.d = 2; return x.c + x.in.d + sizeof(x) / 4 - 3; }
+EOF
+
+check 12 << EOF
+struct pair { int a; int b; };
+int main() { struct pair p, q; p.a = 5; p.b = 7; q = p; return q.a + q.b; }
+EOF
+
+check 10 << EOF
+typedef int myint;
+typedef struct { myint a; myint b; } pair_t, *pair_p;
+int main() { pair_t p; pair_p q; q = &p; q->a = 4; p.b = 6; return p.a + q->b; }
+EOF
+
+check 3 << EOF
+typedef int (*op_t)(int, int);
+int add(int a, int b) { return a + b; }
+int main() { op_t f; f = add; return f(1, 2); }
+EOF
+
+check 4 << EOF
+int main() { typedef long L; L x; x = 4; return sizeof(x) / 2; }
+EOF
+
+check 8 << EOF
+enum color { RED, GREEN = 5, BLUE };
+int main() { enum color c; c = BLUE; return c + RED + sizeof(c) / 2; }
+EOF
+
+check 255 << EOF
+int main() { char c; c = 255; return c == -1 ? 255 : 0; }
+EOF
+
+check 200 << EOF
+int main() { unsigned char c; c = 456; return c; }
+EOF
+
+check 2 << EOF
+int main() { signed char c; c = -2; return -c; }
+EOF
+
+check 255 << EOF
+int main() { unsigned char c; int r; c = 255; r = c++; return r + c; }
+EOF
+
+check 3 << EOF
+int main() { unsigned char c; int r; c = 0; r = c--; return (r == 0) + (c == 255) * 2; }
+EOF
+
+check 3 << EOF
+int main() { char c; int r; c = 127; r = c++; return (r == 127) + (c == -128) * 2; }
+EOF
+
+check 4 << EOF
+int main() { int a[3]; int *p; a[1] = 4; p = a; p++; return *p++; }
+EOF
+
+check 6 << EOF
+int main() { int a[2][3]; a[1][2] = 6; return a[1][2] * sizeof(a) / 24; }
+EOF
+
+check 10 << EOF
+enum { N = 2 * 5 };
+int main() { char buf[N * sizeof(int) - 30]; return sizeof(buf); }
+EOF
+
+check 104 << EOF
+int main() { char *s; s = "hello"; return s[0]; }
+EOF
+
+check 6 << EOF
+int main() { return sizeof("ab" "cde"); }
+EOF
+
+check 8 << EOF
+int len(char s[]) { return sizeof(s); }
+int main() { return len("abc"); }
+EOF
+
+check 3 << EOF
+void set(int *p) { *p = 3; return; }
+int main() { int x; set(&x); return x; }
+EOF
+
+check 4 << EOF
+void nothing(void) { }
+int main(void) { nothing(); return 4; }
+EOF
+
+check 5 << EOF
+extern int printf(const char *__restrict __format, ...) __asm__("" "printf");
+static __inline int twice(int x) __attribute__((__nothrow__, __leaf__));
+static __inline__ int twice(int x) { return x * 2; }
+_Noreturn void stop(void) __attribute__((noreturn));
+int main() { printf("%d", 1); return twice(2) + 1; }
+EOF
+
+check 17 << EOF
+int apply(int, char *, int (*)(int), char[20]);
+int twice(int x) { return x * 2; }
+int apply(int n, char *s, int (*f)(int), char buf[20]) { return f(n) + sizeof(buf) + sizeof(s); }
+int main() { return apply(1, 0, twice, 0) - 1; }
+EOF
+
+check 48 << EOF
+typedef __builtin_va_list gva;
+int main() { __extension__ long long big; va_list ap; gva ap2; char *__restrict p; big = sizeof(ap) + sizeof(ap2); return big; }
+EOF
+
+check 6 << EOF
+int main() { return __extension__ (2 * 3); }
+EOF
+
+check 3 << EOF
+inline int f(void) { return 3; }
+int main() { return f(); }
+EOF
+
+check_error << EOF
+struct s { int a; };
+int main() { struct s x; return x.b; }
+EOF
+
+check_error << EOF
+struct s;
+int main() { struct s x; return 0; }
+EOF
+
+check_error << EOF
+int main() { int x; return x.a; }
+EOF
+
+check_error << EOF
+int main() { int x; return x->a; }
+EOF
+
+check_error << EOF
+struct s { int a; } ;
+struct s { int b; };
+int main() { return 0; }
+EOF
+
+check_error << EOF
+struct s { int a; };
+int f(struct s x) { return 0; }
+int main() { struct s x; return f(x); }
+EOF
+
+check_error << EOF
+int main() { char void x; return 0; }
+EOF
+
+check_error << EOF
+int n = 2;
+int main() { int a[n]; return 0; }
+EOF
+
+check_error << EOF
+struct s { int a : 3; };
+int main() { return 0; }
+EOF
+
+check_error << EOF
+int f(int a, int a) { return a; }
+int main() { return 0; }
+EOF
+
+check_error_at '<input>:4:12:' << EOF
+int main() {
+    int x;
+    x = 1;
+    return y + x;
+}
+EOF
+
+check_error_at '<input>:4:5:' << EOF
+int main() {
+    /* a comment
+       over lines */ int x;
+    y = 1;
+}
+EOF
+
+check_error_at '<input>:2:20:' << EOF
+int main() {
+    return 1 + 2 + 09;
+}
+EOF
+
+check_error_at '<input>:2:15:' << EOF
+int main() { char *s;
+    s = "a" "b\xg"; return 0;
+}
+EOF
+
+check_error_at '<input>:3:16:' << EOF
+#define ONE 1
+int main() {
+    return ONE @;
+}
+EOF
+
+check_error_at '<input>:10:12:' << EOF
+int main() {
+#line 10
+    return z;
+}
+EOF
+
+check_error_at 'inc/twice.h:4:5:' << EOF
+#define twice_line 1
+#include "inc/twice.h"
+int main() { return 0; }
+EOF
+
+check_error_at '<input>:2:2:' << EOF
+int main() {
+#if 1 +
+#endif
+}
+EOF
+
+check_error_at '<input>:1:32:' << EOF
+int main() { int a; int b; int a; return 0; }
+EOF
+
+check_errors 3 << EOF
+int main() {
+    int x;
+    x = ;
+    y = 2;
+    return x +;
+}
+EOF
+
+check_errors 2 << EOF
+int f(int a b) { return a; }
+int g() { return 1 }
+int main() { return g(); }
+EOF
+
+check_errors 3 << EOF
+int main() {
+    if (1) { a = 1; b; }
+    return c;
+}
+EOF
+
+check_errors 2 << EOF
+int x = ;
+int main() { int y; y = 1; return z; }
+EOF
+
+check_errors 1 << EOF
+int main() {
+    return 1
+}
+EOF
+
+check_errors 1 << EOF
+int main() { return 1; }
+}
+EOF
+
+check_errors 2 -fmax-errors=2 << EOF
+int main() {
+    a; b; c; d;
+    return 0;
+}
+EOF
+
+check_errors 4 -fmax-errors=0 << EOF
+int main() {
+    a; b; c; d;
+    return 0;
+}
+EOF
+
+{
+    echo "int x"
+    for i in $(seq 200); do
+        echo "int f$i() { return $i; }"
+    done
+} | check_error_size 400
+
+check_error << EOF
+int main() { return 1
+EOF
+
+check 5 << EOF
+int f() { static int x; x = x + 1; return x; }
+int g() { static int x; x = x + 2; return x; }
+int main() { f(); g(); return f() + g() - 1; }
+EOF
+
+check 4 << EOF
+int x;
+int f() { static int x; x = 3; return x; }
+int main() { x = 1; return f() + x; }
+EOF
+
+check 7 << EOF
+int x;
+int f() { extern int x; x = 6; return x; }
+int main() { f(); return x + 1; }
+EOF
+
+check_error_caret '~~~~~~~~~~~~~~~^' << EOF
+int main() {
+	return y;
+}
+EOF
+
+check_error_caret '~~~~~~~~~~~~~~~^' << EOF
+int main() {
+  	return y;
+}
+EOF
+
+check_error_caret '~~~~~~~~~~~~~~~~~~~~~~~~~~^' << EOF
+#define ONE 1
+int main() {
+	return ONE	+ y;
+}
+EOF
+
+check 127 << EOF
+#include <limits.h>
+int main() {
+    long n;
+    n = INT_MAX == 2147483647;
+    n = n + (LONG_MAX - INT_MAX > 0) * 2;
+    n = n + (SCHAR_MAX == 127) * 4;
+    n = n + (SHRT_MAX == 32767) * 8;
+    n = n + (UCHAR_MAX == 255) * 16;
+    n = n + (CHAR_BIT == 8) * 32;
+    n = n + (INT_MIN < 0) * 64;
+    return n;
+}
+EOF
+
+check 1 << EOF
+#include <limits.h>
+int main() { return LONG_MAX / INT_MAX == 4294967298; }
+EOF
+
+check_error << EOF
+int main() { int x; x = 4; return x / (2 - 2); }
+EOF
+
+check_error << EOF
+int main() { int x; x = 4; return x % (1 - 1); }
+EOF
+
+check_error << EOF
+int main() { int x; x = 4; x /= (long)(3 * 2 - 6); return x; }
+EOF
+
+check 2 << EOF
+int main() { int x; x = 4; return x / (4 - 2); }
+EOF
+
+check 7 << EOF
+struct s { int a; int b; };
+int main() { struct s x; struct s y; int c; x.a = 3; y.a = 7; c = 0; return (c ? x : y).a; }
+EOF
+
+check 12 << EOF
+struct s { int a; char b; long c; };
+int main() { struct s x; struct s y; struct s z; int c; x.c = 12; y.c = 5; c = 1; z = c ? x : y; return z.c; }
+EOF
+
+check 3 << EOF
+struct s { int a; int b; };
+int main() { struct s x; x.b = 3; return (x = x).b; }
+EOF
+
+check_error << EOF
+struct s { int a; };
+struct t { int a; };
+int main() { struct s x; struct t y; int c; c = 1; return (c ? x : y).a; }
+EOF
+
+check_error << EOF
+struct s { int a; };
+int main() { struct s x; int c; c = 1; return (c ? x : 1).a; }
+EOF
+
+check_error << EOF
+struct s { int a; };
+int main() { struct s x; int *p; int c; c = 1; p = c ? p : x; return 0; }
+EOF
+
+check 64 << EOF
+int main() { int i; int s; s = 0; for (i = 0; i < 5000000; i++) s = s + 1; return s % 256; }
+EOF
+
+check 64 << EOF
+int main() { int i; int s; s = 0; i = 0; while (i < 5000000) { s = s + 1; i++; } return s % 256; }
+EOF
+
+check 32 << EOF
+int main() {
+    int i;
+    int j;
+    int s;
+    s = 0;
+    for (i = 0; i < 3000; i++) {
+        j = 0;
+        while (j < 1000) { if (j % 2) s++; else s += 2; j++; }
+        if (i < 0) s = 0;
+    }
+    return s % 256;
+}
+EOF
+
+check 15 << EOF
+int main() { unsigned x; x = 0; return (~x) >> 28; }
+EOF
+
+check 1 << EOF
+int main() { unsigned x; x = 0; return ~x == 4294967295u; }
+EOF
+
+check 1 << EOF
+int main() { unsigned x; long l; x = 5; l = ~x; return l == 4294967290; }
+EOF
+
+check 3 << EOF
+int main() { unsigned char c; c = 0; return (~c == -1) + (sizeof(~c) == 4) * 2; }
+EOF
+
+check 250 << EOF
+int main() { unsigned char c; c = 5; c = ~c; return c; }
+EOF
+
+check 3 << EOF
+int main() { unsigned short s; s = 0; return (~s == -1) + ((unsigned short)~s == 65535) * 2; }
+EOF
+
+check 204 << EOF
+int sum8(int a, int b, int c, int d, int e, int f, int g, int h) { return a + b * 2 + c * 3 + d * 4 + e * 5 + f * 6 + g * 7 + h * 8; }
+int main() { return sum8(1, 2, 3, 4, 5, 6, 7, 8); }
+EOF
+
+check 21 << EOF
+int mix(char a, short b, int c, long d, int e, int f, char g, short h, long i) { return a + b + c + d + e + f + g + h + i; }
+int main() { return mix(1, 2, 3, 4, 5, 6, -7, -8, 15); }
+EOF
+
+check 75 << EOF
+double dsum(double a, double b, double c, double d, double e, double f, double g, double h, float i, int j, double k) {
+    return a + b + c + d + e + f + g + h + i * 2 + j + k;
+}
+int main() { return dsum(1, 2, 3, 4, 5, 6, 7, 8, 9.5, 10, 10); }
+EOF
+
+check 45 << EOF
+int vsum(int n, ...) { va_list ap; va_start(ap, n); int s; s = 0; int i; for (i = 0; i < n; i++) s += va_arg(ap, int); va_end(ap); return s; }
+int main() { return vsum(9, 1, 2, 3, 4, 5, 6, 7, 8, 9); }
+EOF
+
+check 37 << EOF
+int g(int a, int b, int c, int d, int e, int f, int h, ...) { va_list ap; va_start(ap, h); return va_arg(ap, int) + h; }
+int main() { return g(1, 2, 3, 4, 5, 6, 7, 30); }
+EOF
+
+check 7 << EOF
+#include <stdio.h>
+int main() { char buf[16]; sprintf(buf, "%d%d%d%d%d%d%d", 1, 2, 3, 4, 5, 6, 7); return buf[6] - '0'; }
+EOF
+
+check 105 << EOF
+#include <stdio.h>
+int main() { char buf[64]; return sprintf(buf, "%.1f %.1f %.1f %.1f %.1f %.1f %.1f %.1f %.1f %.1f %d %d %d %d %d %d", 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, 10.0, 1, 2, 3, 4, 5, 6) * 2 + 1; }
+EOF
+
+check 3 << EOF
+int f() { int x; x = 1; return x; }
+int main() { int x; x = 2; return x + f(); }
+EOF
+
+check_error << EOF
+int f() { int y; y = 1; return y; }
+int main() { y = 2; return f(); }
+EOF
+
+check 7 << EOF
+int f() { static int c = 5; c++; return c; }
+int main() { f(); return f(); }
+EOF
+
+check 13 << EOF
+int f() { static long n = 3 * 4; static double d = 2.5; static char c = 'a' - 96; return n + c * (d > 2); }
+int main() { return f(); }
+EOF
+
+check 12 << EOF
+int f() { static int c = 5, d = 6; c++; return c + d; }
+int main() { return f(); }
+EOF
+
+check_error << EOF
+int main() { int a; a = 1; static int b = a; return b; }
+EOF
+
+check_error << EOF
+int x;
+int main() { extern int x = 3; return x; }
+EOF
+
+check_error << EOF
+int main() { return sizeof(main); }
+EOF
+
+check_error << EOF
+int f(int a) { return a; }
+int main() { return _Alignof f; }
+EOF
+
+check 8 << EOF
+int f(int a) { return a; }
+int main() { int (*p)(int); p = f; return sizeof(p) + sizeof(f(1)) - 4; }
+EOF
+
+check_error << EOF
+int main() { return sizeof(1lL); }
+EOF
+
+check_error << EOF
+int main() { return sizeof(1Ll); }
+EOF
+
+check_error << EOF
+int main() { return sizeof(1uLLu); }
+EOF
+
+check_error << EOF
+int main() { return sizeof(1lll); }
+EOF
+
+check 48 << EOF
+int main() { return sizeof(1ll) + sizeof(1LL) + sizeof(1uLL) + sizeof(1LLu) + sizeof(1Ul) + sizeof(1lU); }
+EOF
+
+check 1 << EOF
+#if -1 > 0u
+int main() { return 1; }
+#else
+int main() { return 2; }
+#endif
+EOF
+
+check 1 << EOF
+#include <limits.h>
+#if ULONG_MAX > 4294967295 && LONG_MAX > 0 && -1 < 0 && (0u - 1) >> 63 == 1
+int main() { return 1; }
+#else
+int main() { return 2; }
+#endif
+EOF
+
+check 3 << EOF
+#if 0xffffffffffffffff > 0 && 0xffffffffffffffff / 2 == 0x7fffffffffffffff
+int main() { return 3; }
+#endif
+EOF
+
+check 6 << EOF
+#if 0 && (1 / 0)
+int main() { return 1; }
+#elif 1 || 1 % 0
+#if (0 ? 1 / 0 : 2) == 2 && (1 ? 3 : 1 / 0) == 3 && !(0 && 1 / 0)
+int main() { return 6; }
+#endif
+#endif
+EOF
+
+check_error << EOF
+#if 1 && 1 / 0
+#endif
+int main() { return 0; }
+EOF
+
+check_error << EOF
+#if 0 ? 1 : 1 % 0
+#endif
+int main() { return 0; }
+EOF
+
+check_error << EOF
+#if 1lL
+#endif
+int main() { return 0; }
+EOF
+
+check_error << EOF
+int main() { return sizeof(struct S); }
+EOF
+
+check_error << EOF
+struct S;
+int main() { struct S *p; return _Alignof(*p); }
+EOF
+
+check 8 << EOF
+struct S;
+int main() { struct S *p; return sizeof(p); }
+EOF
+
+check 4 << EOF
+struct S;
+struct S { int a; };
+int main() { return sizeof(struct S); }
+EOF
+
+check_error_token '"456" (TK_NUM)' << EOF
+int main() { return 1 456; }
+EOF
+
+check_error_token '"10UL" (TK_NUM)' << EOF
+int main() { return 1 10UL; }
+EOF
+
+check_error_token '"4.5f" (TK_FLOAT)' << EOF
+int main() { return 1 4.5f; }
+EOF
@@ -3,7 +3,9 @@ package token
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 
 	"github.com/ryota-sakamoto/c8go/util"
 )
@@ -17,9 +19,12 @@ const (
 	TK_IF
 	TK_ELSE
 	TK_WHILE
+	TK_FOR
 	TK_SIZEOF
 	TK_IDENT
 	TK_NUM
+	TK_FLOAT
+	TK_STR
 	TK_EOF
 )
 
@@ -33,6 +38,10 @@ func (tk TokenKind) String() string {
 		return "TK_IDENT"
 	case TK_NUM:
 		return "TK_NUM"
+	case TK_FLOAT:
+		return "TK_FLOAT"
+	case TK_STR:
+		return "TK_STR"
 	case TK_EOF:
 		return "TK_EOF"
 	default:
@@ -47,17 +56,58 @@ type Token struct {
 	s    string
 	len  int
 
-	input string
-	line  int
-	pos   int
+	// integer suffix of TK_NUM
+	unsigned bool
+	long     bool
+
+	// TK_FLOAT
+	fval    float64
+	float32 bool
+
+	// the characters of TK_STR
+	str string
+
+	// the token starts at the column pos from 1 of the line from 0 in input,
+	// which is the line lineNo from 1 of file in the source
+	input  string
+	line   int
+	pos    int
+	file   string
+	lineNo int
+}
+
+func (t *Token) Peek() *Token {
+	return t.next
+}
+
+func (t *Token) IsUnsigned() bool {
+	return t.unsigned
 }
 
-func (t *Token) GetInput() string {
-	return t.input
+func (t *Token) IsLong() bool {
+	return t.long
 }
 
-func (t *Token) GetPos() int {
-	return t.pos
+// IsFloat32 reports whether TK_FLOAT has the f suffix.
+func (t *Token) IsFloat32() bool {
+	return t.float32
+}
+
+func (t *Token) IsFloat() bool {
+	return t.kind == TK_FLOAT
+}
+
+func (t *Token) IsString() bool {
+	return t.kind == TK_STR
+}
+
+// Ident returns the name of TK_IDENT without consuming it.
+func (t *Token) Ident() (string, bool) {
+	if !t.isIndent() {
+		return "", false
+	}
+
+	return t.s[:t.len], true
 }
 
 func (t *Token) isNumber() bool {
@@ -70,6 +120,7 @@ func (t *Token) isReserved() bool {
 		t.kind == TK_IF ||
 		t.kind == TK_ELSE ||
 		t.kind == TK_WHILE ||
+		t.kind == TK_FOR ||
 		t.kind == TK_SIZEOF
 }
 
@@ -81,8 +132,12 @@ func (t *Token) isIndent() bool {
 	return t.kind == TK_IDENT
 }
 
+// String returns the text and the kind of t for the error messages.
 func (t Token) String() string {
-	return fmt.Sprintf("s: %q, pos: %d, kind: %s, val: %d, tl: %d", t.s, t.pos, t.kind, t.val, t.len)
+	if t.kind == TK_EOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q (%s)", t.s[:t.len], t.kind)
 }
 
 func (t *Token) Expect(c string) bool {
@@ -119,6 +174,30 @@ func (t *Token) ConsumeNumber() (int, error) {
 	return v, nil
 }
 
+func (t *Token) ConsumeFloat() (float64, error) {
+	if !t.IsFloat() {
+		return 0, t.NewTokenError(util.NotNumberError, "current is not float: %+v", t)
+	}
+	v := t.fval
+	if err := t.Consume(); err != nil {
+		return 0, err
+	}
+
+	return v, nil
+}
+
+func (t *Token) ConsumeString() (string, error) {
+	if !t.IsString() {
+		return "", t.NewTokenError(util.NotExpectedError, "current is not string: %+v", t)
+	}
+	v := t.str
+	if err := t.Consume(); err != nil {
+		return "", err
+	}
+
+	return v, nil
+}
+
 func (t *Token) ConsumeReserved(c string) error {
 	if !t.isReserved() {
 		return t.NewTokenError(util.NotReserverdError, "current is not reversed: %+v, want: %+v", t, c)
@@ -135,131 +214,236 @@ func (t *Token) ConsumeReserved(c string) error {
 func Tokenize(s string) (*Token, error) {
 	token := Token{
 		input: s,
-		pos:   0,
 	}
 	current := &token
+	at := cursor{lineNo: 1}
 	for len(s) > 0 {
-		if s[:1] == " " {
+		// the column is counted in bytes, and a tab is expanded only for the caret of an error
+		if strings.ContainsAny(s[:1], " \t\r\f\v") {
 			s = s[1:]
-			current.pos++
+			at.col++
 			continue
 		}
 
 		if s[:1] == "\n" {
 			s = s[1:]
-			current.line++
-			current.pos = 0
+			at.newline()
 			continue
 		}
 
-		isReserved := false
-		for _, v := range []string{"+", "-", "*", "&", "/", "(", ")", ";", "{", "}", ",", "[", "]"} {
-			if s[:1] == v {
-				isReserved = true
-				break
+		// a line marker of the preprocessor, `# 12 "file.c"`, gives the position
+		// of the next line in the source
+		if s[0] == '#' && at.col == 0 {
+			end := strings.Index(s, "\n")
+			if end < 0 {
+				end = len(s)
 			}
-		}
-		if isReserved {
-			current = newToken(TK_RESERVED, current, s, 1)
-			s = s[1:]
-			current.pos++
+			at.marker(s[:end])
+			s = s[end:]
 			continue
 		}
 
-		isComparisonReserved := false
-		for _, v := range []string{"<", ">", "=", "!"} {
-			if s[:1] == v {
-				isComparisonReserved = true
-				break
+		if strings.HasPrefix(s, "//") {
+			end := strings.Index(s, "\n")
+			if end < 0 {
+				end = len(s)
 			}
+			s = s[end:]
+			continue
 		}
-		if isComparisonReserved {
-			f := false
-			for _, v := range []string{"<=", ">=", "==", "!="} {
-				if s[:2] == v {
-					f = true
-					break
-				}
+
+		if strings.HasPrefix(s, "/*") {
+			end := strings.Index(s[2:], "*/")
+			if end < 0 {
+				return nil, at.error(token.input, "unterminated comment", 0)
 			}
-			if f {
-				current = newToken(TK_RESERVED, current, s, 2)
-				s = s[2:]
-				current.pos += 2
+
+			comment := s[:end+4]
+			s = s[end+4:]
+			if n := strings.Count(comment, "\n"); n > 0 {
+				for i := 0; i < n; i++ {
+					at.newline()
+				}
+				at.col = len(comment) - strings.LastIndex(comment, "\n") - 1
 			} else {
-				current = newToken(TK_RESERVED, current, s, 1)
-				s = s[1:]
-				current.pos++
+				at.col += len(comment)
 			}
 			continue
 		}
 
+		reserved := ""
+		for _, v := range []string{
+			"...", "<<=", ">>=",
+			"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+			"->", "++", "--", "<<", ">>", "<=", ">=", "==", "!=",
+			"+", "-", "*", "&", "|", "^", "~", "/", "%", "(", ")", ";", "{", "}", ",", "[", "]", "?", ":",
+			"<", ">", "=", "!", ".",
+		} {
+			// .5 is a floating constant
+			if v == "." && len(s) > 1 && '0' <= s[1] && s[1] <= '9' {
+				continue
+			}
+			if strings.HasPrefix(s, v) {
+				reserved = v
+				break
+			}
+		}
+		if len(reserved) > 0 {
+			current = newToken(TK_RESERVED, current, s, len(reserved), at)
+			s = s[len(reserved):]
+			at.col += len(reserved)
+			continue
+		}
+
 		if len(s) >= 2 && s[:2] == "if" && !util.IsAlnum(s[2]) {
-			current = newToken(TK_IF, current, s, 2)
+			current = newToken(TK_IF, current, s, 2, at)
 			s = s[2:]
-			current.pos += 2
+			at.col += 2
 			continue
 		}
 
 		if len(s) >= 4 && s[:4] == "else" && !util.IsAlnum(s[4]) {
-			current = newToken(TK_IF, current, s, 4)
+			current = newToken(TK_IF, current, s, 4, at)
 			s = s[4:]
-			current.pos += 4
+			at.col += 4
 			continue
 		}
 
 		if len(s) >= 6 && s[:6] == "return" && !util.IsAlnum(s[6]) {
-			current = newToken(TK_RETURN, current, s, 6)
+			current = newToken(TK_RETURN, current, s, 6, at)
 			s = s[6:]
-			current.pos += 6
+			at.col += 6
 			continue
 		}
 
 		if len(s) >= 5 && s[:5] == "while" && !util.IsAlnum(s[5]) {
-			current = newToken(TK_WHILE, current, s, 5)
+			current = newToken(TK_WHILE, current, s, 5, at)
 			s = s[5:]
-			current.pos += 5
+			at.col += 5
+			continue
+		}
+
+		if len(s) >= 3 && s[:3] == "for" && !util.IsAlnum(s[3]) {
+			current = newToken(TK_FOR, current, s, 3, at)
+			s = s[3:]
+			at.col += 3
 			continue
 		}
 
 		if len(s) >= 6 && s[:6] == "sizeof" && !util.IsAlnum(s[6]) {
-			current = newToken(TK_SIZEOF, current, s, 6)
+			current = newToken(TK_SIZEOF, current, s, 6, at)
 			s = s[6:]
-			current.pos += 6
+			at.col += 6
 			continue
 		}
 
-		isType := false
-		for _, v := range []string{"int"} {
-			if len(s) >= len(v) && s[:len(v)] == v {
-				current = newToken(TK_RESERVED, current, s, len(v))
+		isKeyword := false
+		for _, v := range []string{
+			"int", "short", "long", "unsigned", "signed", "_Bool", "float", "double",
+			"void", "char", "struct", "union", "enum", "__builtin_va_list",
+			"static", "extern", "typedef", "const", "volatile", "_Alignof",
+			"restrict", "__restrict", "__restrict__", "inline", "__inline", "__inline__",
+			"_Noreturn", "__extension__", "__attribute__", "__attribute", "__asm__", "__asm",
+		} {
+			if len(s) >= len(v) && s[:len(v)] == v && !(len(s) > len(v) && util.IsAlnum(s[len(v)])) {
+				current = newToken(TK_RESERVED, current, s, len(v), at)
 				s = s[len(v):]
-				current.pos += len(v)
+				at.col += len(v)
 
-				isType = true
+				isKeyword = true
 				break
 			}
 		}
-		if isType {
+		if isKeyword {
 			continue
 		}
 
-		if _, err := strconv.Atoi(s[:1]); err == nil {
+		if s[0] == '"' {
 			tmp := s
-			num, err := util.ParseInt(&s)
+			str, err := util.ParseString(&s)
 			if err != nil {
-				return nil, util.CompileError{
-					Input:   token.input,
-					Message: err.Error(),
-					Pos:     current.pos + 1,
+				offset := 0
+				if e, ok := err.(util.CharError); ok {
+					offset = e.Offset
 				}
+				return nil, at.error(token.input, err.Error(), offset)
 			}
-			current = newToken(TK_NUM, current, tmp, 1)
-			current.val = num
-			current.pos++
+
+			current = newToken(TK_STR, current, tmp, len(tmp)-len(s), at)
+			current.str = str
+			at.col += len(tmp) - len(s)
+			continue
+		}
+
+		if s[0] == '\'' {
+			tmp := s
+			c, err := util.ParseChar(&s)
+			if err != nil {
+				offset := 0
+				if e, ok := err.(util.CharError); ok {
+					offset = e.Offset
+				}
+				return nil, at.error(token.input, err.Error(), offset)
+			}
+
+			current = newToken(TK_NUM, current, tmp, len(tmp)-len(s), at)
+			current.val = c
+			at.col += len(tmp) - len(s)
 			continue
 		}
 
 		tmp := s
+		f, isFloat, err := util.ParseFloat(&s)
+		if err != nil {
+			return nil, at.error(token.input, err.Error(), 0)
+		}
+		if isFloat {
+			// long double is the same as double
+			float32 := false
+			if len(s) > 0 && (s[0] == 'f' || s[0] == 'F') {
+				float32 = true
+				s = s[1:]
+			} else if len(s) > 0 && (s[0] == 'l' || s[0] == 'L') {
+				s = s[1:]
+			}
+
+			current = newToken(TK_FLOAT, current, tmp, len(tmp)-len(s), at)
+			current.fval = f
+			current.float32 = float32
+			at.col += len(tmp) - len(s)
+			continue
+		}
+
+		if _, err := strconv.Atoi(s[:1]); err == nil {
+			tmp := s
+			num, decimal, err := util.ParseInt(&s)
+			if err != nil {
+				return nil, at.error(token.input, err.Error(), 0)
+			}
+
+			unsigned, long := util.ParseIntSuffix(&s)
+
+			message := ""
+			unsigned, long, ok := literalType(num, decimal, unsigned, long)
+			if !ok {
+				message = "integer literal is too large"
+			}
+			if len(s) > 0 && util.IsAlnum(s[0]) {
+				message = fmt.Sprintf("invalid suffix %q on integer literal", s[:1])
+			}
+			if message != "" {
+				return nil, at.error(token.input, message, 0)
+			}
+
+			current = newToken(TK_NUM, current, tmp, len(tmp)-len(s), at)
+			current.val = int(num)
+			current.unsigned = unsigned
+			current.long = long
+			at.col += len(tmp) - len(s)
+			continue
+		}
+
+		tmp = s
 		varName := ""
 		for len(s) > 0 {
 			c := s[:1]
@@ -271,32 +455,54 @@ func Tokenize(s string) (*Token, error) {
 			break
 		}
 		if len(varName) == 0 {
-			return nil, util.CompileError{
-				Input:   token.input,
-				Message: "varName is empty",
-				Pos:     current.pos + 1,
-			}
+			return nil, at.error(token.input, fmt.Sprintf("invalid character %q", s[:1]), 0)
 		}
 
-		current = newToken(TK_IDENT, current, tmp, len(varName))
-		current.pos++
+		current = newToken(TK_IDENT, current, tmp, len(varName), at)
+		at.col += len(varName)
 		continue
 	}
-	current = newToken(TK_EOF, current, s, 1)
-	current.pos++
+	current = newToken(TK_EOF, current, s, 0, at)
 
 	return token.next, nil
 }
 
-func newToken(kind TokenKind, current *Token, s string, len int) *Token {
+// literalType selects the type of an integer literal v as the first of int,
+// unsigned int, long and unsigned long that can represent it and is allowed by
+// the suffix. A decimal literal is unsigned only with the u suffix.
+func literalType(v uint64, decimal bool, unsigned bool, long bool) (bool, bool, bool) {
+	for _, t := range []struct {
+		unsigned bool
+		long     bool
+		max      uint64
+	}{
+		{false, false, math.MaxInt32},
+		{true, false, math.MaxUint32},
+		{false, true, math.MaxInt64},
+		{true, true, math.MaxUint64},
+	} {
+		if (unsigned && !t.unsigned) || (long && !t.long) || (decimal && !unsigned && t.unsigned) {
+			continue
+		}
+		if v <= t.max {
+			return t.unsigned, t.long, true
+		}
+	}
+
+	return false, false, false
+}
+
+func newToken(kind TokenKind, current *Token, s string, len int, at cursor) *Token {
 	next := Token{
-		kind:  kind,
-		next:  nil,
-		input: current.input,
-		s:     s,
-		len:   len,
-		pos:   current.pos,
-		line:  current.line,
+		kind:   kind,
+		next:   nil,
+		input:  current.input,
+		s:      s,
+		len:    len,
+		pos:    at.col + 1,
+		line:   at.line,
+		file:   at.file,
+		lineNo: at.lineNo,
 	}
 	current.next = &next
 
@@ -304,5 +510,47 @@ func newToken(kind TokenKind, current *Token, s string, len int) *Token {
 }
 
 func (t *Token) NewTokenError(e util.CompileError, format string, a ...interface{}) error {
+	e.File, e.LineNo = t.file, t.lineNo
 	return e.New(t.input, fmt.Sprintf(format, a...), t.pos, t.line)
 }
+
+// cursor is the position of the next character to tokenize.
+type cursor struct {
+	line int
+	col  int
+
+	// the source file and line given by the last line marker
+	file   string
+	lineNo int
+}
+
+func (c *cursor) newline() {
+	c.line++
+	c.lineNo++
+	c.col = 0
+}
+
+// marker applies the line marker `# 12 "file.c"` on the current line to the next line.
+// Other lines starting with # are ignored.
+func (c *cursor) marker(line string) {
+	fields := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), " ", 2)
+	n, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return
+	}
+
+	// newline moves to the line n
+	c.lineNo = n - 1
+	if len(fields) > 1 {
+		if name, err := strconv.Unquote(strings.TrimSpace(fields[1])); err == nil {
+			c.file = name
+		}
+	}
+}
+
+// error returns an error at offset bytes after c.
+func (c cursor) error(input string, message string, offset int) error {
+	e := util.InvalidTokenError
+	e.File, e.LineNo = c.file, c.lineNo
+	return e.New(input, message, c.col+offset+1, c.line)
+}
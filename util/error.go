@@ -11,30 +11,95 @@ var (
 	NotVariableError  = CompileError{errorType: "NotVariableError"}
 	EmptyVarName      = CompileError{errorType: "EmptyVarName"}
 	NotNumberError    = CompileError{errorType: "NotNumberError"}
+
+	DivisionByZeroError = CompileError{errorType: "DivisionByZeroError"}
+	NotLvalueError      = CompileError{errorType: "NotLvalueError"}
+	NotTypeError        = CompileError{errorType: "NotTypeError"}
+	InvalidTypeError    = CompileError{errorType: "InvalidTypeError"}
+	InvalidOperandError = CompileError{errorType: "InvalidOperandError"}
+	NotFunctionError    = CompileError{errorType: "NotFunctionError"}
+	NotVariadicError    = CompileError{errorType: "NotVariadicError"}
+	ConstAssignError    = CompileError{errorType: "ConstAssignError"}
+	NotConstantError    = CompileError{errorType: "NotConstantError"}
+	RedefinedError      = CompileError{errorType: "RedefinedError"}
+	InvalidTokenError   = CompileError{errorType: "InvalidTokenError"}
+
+	PreprocessError = CompileError{errorType: "PreprocessError"}
 )
 
+// CompileError is an error at the column Pos from 1 of the line Line from 0 in Input.
+// File and LineNo locate it in the source, which differs from Input after the
+// preprocessor. LineNo starts at 1, and Line + 1 is reported when it is 0.
 type CompileError struct {
 	errorType string
 	Input     string
 	Message   string
 	Pos       int
 	Line      int
+	File      string
+	LineNo    int
 }
 
 func (t CompileError) Error() string {
 	s := fmt.Sprintf(`compile error: %s
+%s: %s
 ----------
-`, t.errorType)
-	for i, v := range strings.Split(t.Input, "\n") {
-		s += fmt.Sprintf("%s\n", v)
-		if t.Line == i {
-			s += fmt.Sprintf("%s\n%s\n", strings.Repeat("~", t.Pos-1)+"^", t.Message)
+`, t.errorType, t.location(), t.Message)
+
+	lines := strings.Split(t.Input, "\n")
+	for i := t.Line - contextLines; i < t.Line; i++ {
+		if i < 0 || isLineMarker(lines[i]) {
+			continue
 		}
+		s += fmt.Sprintf("%s\n", strings.TrimSuffix(lines[i], "\r"))
+	}
+	if 0 <= t.Line && t.Line < len(lines) {
+		v := strings.TrimSuffix(lines[t.Line], "\r")
+		s += fmt.Sprintf("%s\n%s\n", v, strings.Repeat("~", width(v, t.Pos-1))+"^")
 	}
 
 	return s
 }
 
+// location returns `file:line:col` of the error, or `line:col` without File.
+func (t CompileError) location() string {
+	line := t.LineNo
+	if line == 0 {
+		line = t.Line + 1
+	}
+
+	if t.File == "" {
+		return fmt.Sprintf("%d:%d", line, t.Pos)
+	}
+	return fmt.Sprintf("%s:%d:%d", t.File, line, t.Pos)
+}
+
+// contextLines is the number of lines shown before the line of an error.
+const contextLines = 2
+
+// isLineMarker reports whether line is a line marker of the preprocessor, `# 12 "file.c"`.
+func isLineMarker(line string) bool {
+	return len(line) > 2 && strings.HasPrefix(line, "# ") && '0' <= line[2] && line[2] <= '9'
+}
+
+// tabStop is the width of a tab on the terminal.
+const tabStop = 8
+
+// width returns the display width of the first n bytes of line, where a tab
+// advances to the next tab stop. A position past the end of line counts as one.
+func width(line string, n int) int {
+	w := 0
+	for i := 0; i < n; i++ {
+		if i < len(line) && line[i] == '\t' {
+			w += tabStop - w%tabStop
+		} else {
+			w++
+		}
+	}
+
+	return w
+}
+
 func (t *CompileError) New(input string, message string, pos int, line int) error {
 	t.Pos = pos
 	t.Line = line
@@ -42,3 +107,15 @@ func (t *CompileError) New(input string, message string, pos int, line int) erro
 	t.Message = message
 	return t
 }
+
+// ErrorList is the errors found in a compilation, in the order they were found.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	s := []string{}
+	for _, err := range l {
+		s = append(s, err.Error())
+	}
+
+	return strings.Join(s, "\n")
+}
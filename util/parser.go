@@ -2,28 +2,278 @@ package util
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
-	"unicode"
+	"strings"
 )
 
-func ParseInt(s *string) (int, error) {
-	t := []rune{}
-	index := 0
-	for _, c := range *s {
-		if unicode.IsDigit(c) {
-			t = append(t, c)
-			index++
-		} else {
+// ParseInt parses a decimal, 0x hexadecimal, 0 octal or 0b binary integer constant
+// without its suffix, and reports whether it is decimal.
+func ParseInt(s *string) (uint64, bool, error) {
+	str := *s
+	base, start := 10, 0
+	switch {
+	case len(str) >= 2 && str[0] == '0' && (str[1] == 'x' || str[1] == 'X'):
+		base, start = 16, 2
+	case len(str) >= 2 && str[0] == '0' && (str[1] == 'b' || str[1] == 'B'):
+		base, start = 2, 2
+	case len(str) >= 2 && str[0] == '0':
+		base = 8
+	}
+
+	// all the digits are taken so that `08` is an error rather than two numbers
+	i := start
+	for i < len(str) && (isDigit(str[i]) || (base == 16 && isHexDigit(str[i]))) {
+		i++
+	}
+	if i == start {
+		return 0, false, errors.New("no digits in integer literal")
+	}
+
+	v, err := strconv.ParseUint(str[start:i], base, 64)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+			return 0, false, errors.New("integer literal is too large")
+		}
+		return 0, false, fmt.Errorf("invalid digit in base %d literal %q", base, str[:i])
+	}
+
+	*s = str[i:]
+	return v, base == 10, nil
+}
+
+// ParseIntSuffix parses the suffix of an integer constant, which is u, l or ll
+// in any order with the two l of ll in the same case, and reports whether it
+// has u and l.
+func ParseIntSuffix(s *string) (bool, bool) {
+	unsigned, long := false, false
+	for i := 0; i < 2; i++ {
+		if !unsigned && len(*s) > 0 && ((*s)[0] == 'u' || (*s)[0] == 'U') {
+			unsigned = true
+			*s = (*s)[1:]
+			continue
+		}
+		for _, suffix := range []string{"ll", "LL", "l", "L"} {
+			if !long && strings.HasPrefix(*s, suffix) {
+				long = true
+				*s = (*s)[len(suffix):]
+				break
+			}
+		}
+	}
+
+	return unsigned, long
+}
+
+// ParseFloat parses a decimal floating constant such as `1.5`, `.5` or `1e-3`.
+// It returns false when the head of s is not a floating constant.
+func ParseFloat(s *string) (float64, bool, error) {
+	i := 0
+	for i < len(*s) && isDigit((*s)[i]) {
+		i++
+	}
+	digits := i
+
+	isFloat := false
+	if i < len(*s) && (*s)[i] == '.' {
+		isFloat = true
+		i++
+		for i < len(*s) && isDigit((*s)[i]) {
+			i++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false, nil
+	}
+
+	if i < len(*s) && ((*s)[i] == 'e' || (*s)[i] == 'E') {
+		j := i + 1
+		if j < len(*s) && ((*s)[j] == '+' || (*s)[j] == '-') {
+			j++
+		}
+		if j >= len(*s) || !isDigit((*s)[j]) {
+			return 0, false, errors.New("exponent has no digits")
+		}
+		for j < len(*s) && isDigit((*s)[j]) {
+			j++
+		}
+		isFloat = true
+		i = j
+	}
+	if !isFloat {
+		return 0, false, nil
+	}
+
+	f, err := strconv.ParseFloat((*s)[:i], 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	*s = (*s)[i:]
+	return f, true, nil
+}
+
+// CharError is an error in a character constant or a string literal at Offset
+// bytes from its opening quote.
+type CharError struct {
+	Offset  int
+	Message string
+}
+
+func (e CharError) Error() string {
+	return e.Message
+}
+
+// ParseChar parses a character constant such as 'a', '\n' or the multi-character 'ab'.
+// The value has type int: a single character is sign extended from char, and each
+// character of a multi-character constant is shifted in from the low byte.
+func ParseChar(s *string) (int, error) {
+	str := *s
+	if len(str) == 0 || str[0] != '\'' {
+		return 0, CharError{Offset: 0, Message: "not a character constant"}
+	}
+
+	chars := []int{}
+	i := 1
+	for {
+		if i >= len(str) || str[i] == '\n' {
+			return 0, CharError{Offset: 0, Message: "unterminated character constant"}
+		}
+		if str[i] == '\'' {
+			break
+		}
+
+		if str[i] == '\\' {
+			c, n, err := parseEscape(str[i:])
+			if err != nil {
+				return 0, CharError{Offset: i, Message: err.Error()}
+			}
+			chars = append(chars, c)
+			i += n
+			continue
+		}
+
+		chars = append(chars, int(str[i]))
+		i++
+	}
+
+	if len(chars) == 0 {
+		return 0, CharError{Offset: 0, Message: "empty character constant"}
+	}
+
+	*s = str[i+1:]
+	if len(chars) == 1 {
+		return int(int8(chars[0])), nil
+	}
+
+	v := 0
+	for _, c := range chars {
+		v = v<<8 | c
+	}
+	return int(int32(v)), nil
+}
+
+// ParseString parses a string literal such as "a\\n", and returns its characters
+// without the terminating null character.
+func ParseString(s *string) (string, error) {
+	str := *s
+	if len(str) == 0 || str[0] != '"' {
+		return "", CharError{Offset: 0, Message: "not a string literal"}
+	}
+
+	chars := []byte{}
+	i := 1
+	for {
+		if i >= len(str) || str[i] == '\n' {
+			return "", CharError{Offset: 0, Message: "unterminated string literal"}
+		}
+		if str[i] == '"' {
 			break
 		}
+
+		if str[i] == '\\' {
+			c, n, err := parseEscape(str[i:])
+			if err != nil {
+				return "", CharError{Offset: i, Message: err.Error()}
+			}
+			chars = append(chars, byte(c))
+			i += n
+			continue
+		}
+
+		chars = append(chars, str[i])
+		i++
+	}
+
+	*s = str[i+1:]
+	return string(chars), nil
+}
+
+// parseEscape parses an escape sequence at the head of s, and returns its value
+// and length.
+func parseEscape(s string) (int, int, error) {
+	if len(s) < 2 || s[1] == '\n' {
+		return 0, 0, errors.New("incomplete escape sequence")
+	}
+
+	switch c := s[1]; {
+	case '0' <= c && c <= '7':
+		v, i := 0, 1
+		for i < len(s) && i <= 3 && '0' <= s[i] && s[i] <= '7' {
+			v = v*8 + int(s[i]-'0')
+			i++
+		}
+		if v > 0xff {
+			return 0, 0, errors.New("octal escape sequence out of range")
+		}
+		return v, i, nil
+	case c == 'x':
+		v, i := 0, 2
+		for i < len(s) && isHexDigit(s[i]) {
+			d, _ := strconv.ParseInt(s[i:i+1], 16, 0)
+			v = v*16 + int(d)
+			if v > 0xff {
+				return 0, 0, errors.New("hex escape sequence out of range")
+			}
+			i++
+		}
+		if i == 2 {
+			return 0, 0, errors.New("\\x used with no following hex digits")
+		}
+		return v, i, nil
 	}
 
-	if index == 0 {
-		return 0, errors.New("not number")
+	switch s[1] {
+	case 'a':
+		return 7, 2, nil
+	case 'b':
+		return 8, 2, nil
+	case 'f':
+		return 12, 2, nil
+	case 'n':
+		return 10, 2, nil
+	case 'r':
+		return 13, 2, nil
+	case 't':
+		return 9, 2, nil
+	case 'v':
+		return 11, 2, nil
+	case 'e':
+		// GNU extension
+		return 27, 2, nil
 	}
 
-	*s = (*s)[index:]
-	return strconv.Atoi(string(t))
+	// \\, \', \", \? and unknown escapes are the character itself
+	return int(s[1]), 2, nil
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
 
 func IsAlnum(c byte) bool {
@@ -15,17 +15,26 @@ func (l LocalVariales) Get(name string) (Variable, bool) {
 }
 
 func (l *LocalVariales) Set(v Variable) {
-	switch v.Type {
-	case ArrayType:
-		v.Offset = l.maxOffset + 8
-		l.maxOffset += 8 * v.ArraySize
-	default:
-		v.Offset = l.maxOffset + 8
-		l.maxOffset += 8
-	}
+	l.maxOffset = alignTo(l.maxOffset+v.Size(), v.Align())
+	v.Offset = l.maxOffset
+	l.vars[v.Name] = v
+}
+
+// Declare adds v, which has static storage and a Label, without allocating it
+// in the frame.
+func (l *LocalVariales) Declare(v Variable) {
 	l.vars[v.Name] = v
 }
 
+// StackSize returns the frame size needed for all variables defined so far.
+func (l LocalVariales) StackSize() int {
+	return alignTo(l.maxOffset, 16)
+}
+
+func alignTo(n int, align int) int {
+	return (n + align - 1) / align * align
+}
+
 func NewLocalVariales() LocalVariales {
 	return LocalVariales{
 		vars:      map[string]Variable{},
@@ -33,12 +42,78 @@ func NewLocalVariales() LocalVariales {
 	}
 }
 
+// Variable is a variable or, without Name and Offset, the type of an expression.
+// Pointer is the pointed type of PointerType and the element type of ArrayType.
+// Return, Params and Variadic describe FuncType.
+// Struct describes StructType, and is shared so that completing a struct completes its uses.
+// Label is the symbol of a variable with static storage, which has no Offset.
+// Const and Volatile are the qualifiers of the type itself, e.g. of the pointer for `int *const`.
 type Variable struct {
 	Name      string
 	Type      Type
+	Unsigned  bool
 	Pointer   *Variable
 	Offset    int
 	ArraySize int
+	Return    *Variable
+	Params    []Variable
+	Variadic  bool
+	Struct    *Struct
+	Label     string
+	Const     bool
+	Volatile  bool
+}
+
+// Struct is a struct or union. The Offset of each member is from the start of
+// the struct, and a member without Name is an anonymous struct or union.
+type Struct struct {
+	Tag      string
+	Union    bool
+	Members  []Variable
+	Complete bool
+	size     int
+	align    int
+}
+
+// Define completes s with the members, and lays them out.
+func (s *Struct) Define(members []Variable) {
+	s.size, s.align = 0, 1
+	for i := range members {
+		m := &members[i]
+		if s.Union {
+			m.Offset = 0
+		} else {
+			m.Offset = alignTo(s.size, m.Align())
+		}
+		if end := m.Offset + m.Size(); end > s.size {
+			s.size = end
+		}
+		if m.Align() > s.align {
+			s.align = m.Align()
+		}
+	}
+
+	s.size = alignTo(s.size, s.align)
+	s.Members = members
+	s.Complete = true
+}
+
+// Member returns the member named name, which may be in an anonymous member,
+// with its Offset from the start of s.
+func (s *Struct) Member(name string) (Variable, bool) {
+	for _, m := range s.Members {
+		if m.Name == name {
+			return m, true
+		}
+		if m.Name == "" && m.Type == StructType {
+			if v, ok := m.Struct.Member(name); ok {
+				v.Offset += m.Offset
+				return v, true
+			}
+		}
+	}
+
+	return Variable{}, false
 }
 
 func NewVariable(name string, t Type) Variable {
@@ -48,10 +123,85 @@ func NewVariable(name string, t Type) Variable {
 	}
 }
 
+func PointerTo(v Variable) Variable {
+	return Variable{
+		Type:    PointerType,
+		Pointer: &v,
+	}
+}
+
+func ArrayOf(v Variable, n int) Variable {
+	return Variable{
+		Type:      ArrayType,
+		Pointer:   &v,
+		ArraySize: n,
+	}
+}
+
+func FuncOf(ret Variable, params []Variable) Variable {
+	return Variable{
+		Type:   FuncType,
+		Return: &ret,
+		Params: params,
+	}
+}
+
 func (v Variable) IsPointerType() bool {
 	return v.Pointer != nil && v.Type == PointerType
 }
 
+func (v Variable) IsInteger() bool {
+	return v.Type == BoolType || v.Type == CharType || v.Type == ShortType || v.Type == IntType || v.Type == LongType
+}
+
+func (v Variable) IsFloat() bool {
+	return v.Type == FloatType || v.Type == DoubleType
+}
+
+func (v Variable) IsArithmetic() bool {
+	return v.IsInteger() || v.IsFloat()
+}
+
+// IsPointerLike reports whether v is a pointer or an array which decays to a pointer.
+func (v Variable) IsPointerLike() bool {
+	return v.Pointer != nil && (v.Type == PointerType || v.Type == ArrayType)
+}
+
+func (v Variable) Size() int {
+	switch v.Type {
+	case BoolType, CharType, VoidType:
+		// sizeof(void) is 1 as a GNU extension
+		return 1
+	case StructType:
+		return v.Struct.size
+	case ShortType:
+		return 2
+	case LongType, PointerType, DoubleType:
+		return 8
+	case ArrayType:
+		return v.Pointer.Size() * v.ArraySize
+	default:
+		return 4
+	}
+}
+
+func (v Variable) Align() int {
+	switch v.Type {
+	case BoolType, CharType, VoidType:
+		return 1
+	case StructType:
+		return v.Struct.align
+	case ShortType:
+		return 2
+	case LongType, PointerType, DoubleType:
+		return 8
+	case ArrayType:
+		return v.Pointer.Align()
+	default:
+		return 4
+	}
+}
+
 func (v *Variable) Next() error {
 	if v.Type != PointerType {
 		return errors.Errorf("%s is not PointerType", v.Type)
@@ -70,9 +220,21 @@ const (
 	IntType
 	PointerType
 	ArrayType
+	ShortType
+	LongType
+	BoolType
+	FloatType
+	DoubleType
+	FuncType
+	VoidType
+	CharType
+	StructType
 )
 
-var s = []string{"Unknown", "IntType", "PointerType", "ArrayType"}
+var s = []string{
+	"Unknown", "IntType", "PointerType", "ArrayType", "ShortType", "LongType", "BoolType",
+	"FloatType", "DoubleType", "FuncType", "VoidType", "CharType", "StructType",
+}
 
 func (t Type) String() string {
 	return s[t]